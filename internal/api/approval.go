@@ -0,0 +1,160 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/jsonapi"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"schrodinger-box/internal/misc"
+	"schrodinger-box/internal/model"
+)
+
+/*
+ * Handlers for /event/:id/pending_signups actions : approval of signups of events requiring approval
+ */
+
+// pending signups are listed in the order they are created, with users, guests and answers to registration questions
+func EventPendingSignupsGet(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to view pending signups")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	event := &model.Event{}
+	var signups []*model.EventSignup
+	if err := db.First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !requireStaffRole(ctx, db, event, user, model.ManagerRoles, "only organizers can view pending signups") {
+		return
+	} else if err := db.Preload("User").
+		Where("event_id = ? AND status = ?", event.ID, model.SignupPending).
+		Order("created_at asc, id asc").
+		Find(&signups).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, signup := range signups {
+		if err := signup.LoadAnswers(); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		} else if err := signup.LoadGuests(); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	ctx.Status(http.StatusOK)
+	if err := jsonapi.MarshalPayload(ctx.Writer, signups); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func EventSignupApprove(ctx *gin.Context) {
+	decideSignup(ctx, true)
+}
+
+func EventSignupReject(ctx *gin.Context) {
+	decideSignup(ctx, false)
+}
+
+// decideSignup approves or rejects a pending signup, an optional decision_message is sent to the applicant
+// Status codes:
+// - 200 : signup has been approved (it is waitlisted if the event is full) or rejected
+// - 400 : payload is invalid, places of the event are allocated by lottery or the event is no longer active
+// - 403 : the user is not an organizer of the event
+// - 404 : event or signup does not exist
+// - 409 : signup is not pending
+func decideSignup(ctx *gin.Context, approve bool) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to approve or reject signups")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	signupRequest := &model.EventSignup{}
+	// the message is optional so the payload can be omitted
+	if ctx.Request.ContentLength != 0 {
+		if err := jsonapi.UnmarshalPayload(ctx.Request.Body, signupRequest); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusBadRequest, "cannot unmarshal JSON of request: "+err.Error())
+			return
+		}
+	}
+	message := ""
+	if signupRequest.DecisionMessage != nil {
+		message = *signupRequest.DecisionMessage
+	}
+	if len(message) > model.MaxDecisionMessageLength {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, fmt.Sprintf("message must not be longer than %d characters", model.MaxDecisionMessageLength))
+		return
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	event := &model.Event{}
+	signup := &model.EventSignup{}
+	// the event row is locked so that concurrent approvals cannot exceed its capacity
+	tx := db.Begin()
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !requireStaffRole(ctx, tx, event, user, model.ManagerRoles, "only organizers can approve or reject signups") {
+		tx.Rollback()
+		return
+	} else if event.IsLottery() {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "places of lottery events are allocated by the draw")
+		return
+	} else if !event.IsActive() {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, fmt.Sprintf("signups of events which have been %s cannot be approved or rejected", *event.Status))
+		return
+	}
+	if err := tx.Preload("User").Preload("User.Subscription").
+		Where("event_id = ?", event.ID).
+		First(signup, ctx.Param("signup_id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "signup does not exist")
+		return
+	} else if err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if *signup.Status != model.SignupPending {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusConflict, "only pending signups can be approved or rejected")
+		return
+	}
+	if err := event.DecideSignup(tx, signup, approve, message, time.Now()); errors.Is(err, model.ErrSignupTransition) {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.Status(http.StatusOK)
+	if err := jsonapi.MarshalPayload(ctx.Writer, signup); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
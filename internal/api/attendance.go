@@ -0,0 +1,272 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/jsonapi"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"schrodinger-box/internal/misc"
+	"schrodinger-box/internal/model"
+)
+
+/*
+ * Handlers for /event/:id/attendance & /event/:id/roster actions : bulk attendance marking & roster export
+ */
+
+// maximum number of signups which can be updated in a single bulk request
+const maxAttendanceItems = 500
+
+// statuses which can be set in bulk and the signup actions setting them
+// attendance marked by mistake can be reverted as long as the user has not left a review
+var attendanceActions = map[string]string{
+	model.SignupAttended: model.SignupMarkAttended,
+	model.SignupNoShow:   model.SignupMarkNoShow,
+	model.SignupCreated:  model.SignupRevertAttendance,
+}
+
+// the payload is a JSON:API resource object of type event_attendance, with signups given by ID or NUSID of the users
+type attendanceRequest struct {
+	Data struct {
+		Type       string `json:"type"`
+		Attributes struct {
+			Status    *string  `json:"status"`
+			SignupIDs []uint   `json:"signup_ids"`
+			NUSIDs    []string `json:"nusids"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+// Result codes:
+// - updated   : status of the signup has been set
+// - unchanged : the signup is already in the status requested
+// - not_found : there is no signup of this event with the ID or NUSID given
+// - rejected  : status of the signup cannot be changed to the one requested, e.g. waitlisted or withdrawn
+type attendanceResult struct {
+	SignupID *uint  `json:"signup_id,omitempty"`
+	NUSID    string `json:"nusid,omitempty"`
+	Result   string `json:"result"`
+	Status   string `json:"status,omitempty"`
+}
+
+// all signups are updated in one transaction, signups which cannot be updated are reported without failing the request
+// Status codes:
+// - 200 : request processed, the result of each signup is in meta.results
+// - 400 : payload is invalid
+// - 403 : the user is not event staff
+// - 404 : event does not exist
+func EventAttendanceUpdate(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to mark attendance")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	request := &attendanceRequest{}
+	attributes := &request.Data.Attributes
+	if err := json.NewDecoder(ctx.Request.Body).Decode(request); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "cannot unmarshal JSON of request: "+err.Error())
+		return
+	} else if request.Data.Type != "event_attendance" {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "resource object must be of type event_attendance")
+		return
+	} else if attributes.Status == nil || (len(attributes.SignupIDs) == 0 && len(attributes.NUSIDs) == 0) {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "status and at least one signup ID or NUSID must be provided")
+		return
+	} else if _, ok := attendanceActions[*attributes.Status]; !ok {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "status can only be set to attended, no_show or created")
+		return
+	} else if len(attributes.SignupIDs)+len(attributes.NUSIDs) > maxAttendanceItems {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, fmt.Sprintf("at most %d signups can be updated at once", maxAttendanceItems))
+		return
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	event := &model.Event{}
+	if err := db.First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !requireStaffRole(ctx, db, event, user, model.AttendanceRoles, "only event staff can mark attendance") {
+		return
+	}
+	results := make([]*attendanceResult, 0, len(attributes.SignupIDs)+len(attributes.NUSIDs))
+	updated := 0
+	tx := db.Begin()
+	mark := func(result *attendanceResult, query *gorm.DB) error {
+		signup := &model.EventSignup{}
+		if err := query.Clauses(clause.Locking{Strength: "UPDATE"}).First(signup).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			result.Result = "not_found"
+			return nil
+		} else if err != nil {
+			return err
+		}
+		result.SignupID = &signup.ID
+		result.Status = *signup.Status
+		if *signup.Status == *attributes.Status {
+			result.Result = "unchanged"
+		} else if err := signup.Transition(tx, attendanceActions[*attributes.Status], nil); errors.Is(err, model.ErrSignupTransition) {
+			result.Result = "rejected"
+		} else if err != nil {
+			return err
+		} else {
+			result.Result = "updated"
+			result.Status = *attributes.Status
+			updated++
+		}
+		return nil
+	}
+	for _, id := range attributes.SignupIDs {
+		id := id
+		result := &attendanceResult{SignupID: &id}
+		results = append(results, result)
+		if err := mark(result, tx.Where("event_id = ? AND id = ?", event.ID, id)); err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	for _, nusid := range attributes.NUSIDs {
+		result := &attendanceResult{NUSID: nusid}
+		results = append(results, result)
+		// a user may have withdrawn and signed up again, only the latest signup counts
+		query := tx.Joins("JOIN users ON users.id = event_signups.user_id").
+			Where("event_signups.event_id = ? AND users.nus_id = ? AND event_signups.status <> ?", event.ID, nusid, "withdrawn").
+			Order("event_signups.id desc")
+		if err := mark(result, query); err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.JSON(http.StatusOK, map[string]map[string]interface{}{
+		"meta": {
+			"updated": updated,
+			"results": results,
+		},
+	})
+}
+
+// columns of the roster exported as CSV
+var rosterColumns = []string{"signup_id", "user_id", "nickname", "fullname", "email", "nusid", "status", "attendance_mode",
+	"guest_count", "guests", "transfer_to_id", "transferred_from_id", "transferred_at", "review_score", "review_text", "signed_up_at"}
+
+// the roster includes all signups of the event, including waitlisted and withdrawn ones, with guests, transfers and answers to registration questions
+// Query parameters:
+// - format : json (default), as JSON:API signup resources with users included, or csv
+func EventRosterGet(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to export roster")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	format := ctx.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		misc.ReturnErrors(ctx, http.StatusBadRequest, []*misc.ErrorObject{misc.ParameterError("format", "format must be either json or csv")})
+		return
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	event := &model.Event{}
+	var signups []*model.EventSignup
+	if err := db.First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !requireStaffRole(ctx, db, event, user, model.ManagerRoles, "only organizers can export roster") {
+		return
+	} else if err := db.Preload("User").Where("event_id = ?", event.ID).Order("id").Find(&signups).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, signup := range signups {
+		if err := signup.LoadAnswers(); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		} else if err := signup.LoadGuests(); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if format == "json" {
+		ctx.Status(http.StatusOK)
+		if err := jsonapi.MarshalPayload(ctx.Writer, signups); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"event-%d-roster.csv\"", event.ID))
+	ctx.Status(http.StatusOK)
+	// answers to registration questions follow the fixed columns, one column for each question
+	questions := event.QuestionList()
+	header := append([]string{}, rosterColumns...)
+	for _, question := range questions {
+		header = append(header, question.Label)
+	}
+	writer := csv.NewWriter(ctx.Writer)
+	writer.Write(csvCells(header))
+	for _, signup := range signups {
+		row := []string{fmt.Sprint(signup.ID), fmt.Sprint(*signup.UserID), "", "", "", "", *signup.Status, signup.Mode(),
+			fmt.Sprint(signup.Places() - 1), "", "", "", "", "", "", signup.CreatedAt.Format(time.RFC3339)}
+		if signup.User != nil {
+			row[2], row[3], row[4], row[5] = *signup.User.Nickname, signup.User.Fullname, signup.User.Email, signup.User.NUSID
+		}
+		// names of guests are separated by semicolons in a single column
+		if guests, ok := signup.Guests.([]string); ok {
+			row[9] = strings.Join(guests, "; ")
+		}
+		if signup.TransferToID != nil {
+			row[10] = fmt.Sprint(*signup.TransferToID)
+		}
+		if signup.TransferredFromID != nil {
+			row[11] = fmt.Sprint(*signup.TransferredFromID)
+		}
+		if signup.TransferredAt != nil {
+			row[12] = signup.TransferredAt.Format(time.RFC3339)
+		}
+		if signup.ReviewScore != nil {
+			row[13] = fmt.Sprint(*signup.ReviewScore)
+		}
+		if signup.ReviewText != nil {
+			row[14] = *signup.ReviewText
+		}
+		answers, _ := signup.Answers.(map[string]interface{})
+		for _, question := range questions {
+			row = append(row, question.Format(answers[question.ID]))
+		}
+		writer.Write(csvCells(row))
+	}
+	writer.Flush()
+}
+
+// csvCells escapes cells which spreadsheet applications would evaluate as formulas, e.g. nicknames or answers starting with "="
+// such cells are prefixed with a single quote so that they are shown as text
+func csvCells(row []string) []string {
+	escaped := make([]string, len(row))
+	for i, cell := range row {
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			cell = "'" + cell
+		}
+		escaped[i] = cell
+	}
+	return escaped
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+
+	"schrodinger-box/internal/misc"
+	"schrodinger-box/internal/model"
+)
+
+// This file contains handlers exporting events in iCalendar format
+
+const CalendarContentType = "text/calendar; charset=utf-8"
+
+func EventICS(ctx *gin.Context) {
+	id := ctx.Param("id")
+	event := &model.Event{}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	if err := db.Preload("Organizer").First(event, id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if visible, err := event.VisibleTo(db, optionalUser(ctx), ctx.Query("invite")); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !visible {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err := event.HideLocationFrom(db, optionalUser(ctx)); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.Header("Content-Type", CalendarContentType)
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"event-%d.ics\"", event.ID))
+	ctx.Status(http.StatusOK)
+	if err := misc.WriteICalendar(ctx.Writer, *event.Title, []*misc.ICalEvent{icalEvent(event, "")}); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// this generates a new secret feed URL for the user, any URL generated before stops working
+func CalendarFeedCreate(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to subscribe to calendar feed")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	secret := uuid.New().String()
+	db := ctx.MustGet("DB").(*gorm.DB)
+	if err := db.Model(user).Update("calendar_secret", secret).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	feedURL := misc.APIAbsolutePath("/calendar_feed/" + secret)
+	ctx.JSON(http.StatusCreated, map[string]map[string]string{
+		"meta": {
+			"feed_url":   feedURL,
+			"webcal_url": "webcal://" + strings.SplitN(feedURL, "://", 2)[1],
+		},
+	})
+}
+
+func CalendarFeedDelete(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to disable calendar feed")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	if err := db.Model(user).Update("calendar_secret", nil).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else {
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+// calendar apps cannot send X-Token-* headers, the feed is authenticated by the secret in its URL instead
+func CalendarFeedGet(ctx *gin.Context) {
+	secret := ctx.Param("secret")
+	user := &model.User{}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	if err := db.Where("calendar_secret = ?", secret).First(user).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "calendar feed does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var signups []*model.EventSignup
+	var events []*model.Event
+	if err := db.Where("user_id = ? AND status NOT IN ?", user.ID, model.UnlistedStatuses).Find(&signups).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	signupStatus := make(map[uint]string)
+	signedUp := make([]uint, 0, len(signups))
+	for _, signup := range signups {
+		signupStatus[*signup.EventID] = *signup.Status
+		signedUp = append(signedUp, *signup.EventID)
+	}
+	if err := db.Preload("Organizer").
+		Where("organizer_id = ? OR id IN (?)", user.ID, signedUp).
+		Order("time_begin asc").
+		Find(&events).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	icalEvents := make([]*misc.ICalEvent, 0, len(events))
+	for _, event := range events {
+		if err := event.HideLocationFrom(db, user); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		}
+		icalEvents = append(icalEvents, icalEvent(event, signupStatus[event.ID]))
+	}
+	ctx.Header("Content-Type", CalendarContentType)
+	ctx.Status(http.StatusOK)
+	if err := misc.WriteICalendar(ctx.Writer, "Schrodinger's Box - "+*user.Nickname, icalEvents); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// icalEvent converts an event into a VEVENT, signupStatus is the status of the viewer's signup if there is one
+func icalEvent(event *model.Event, signupStatus string) *misc.ICalEvent {
+	host := viper.GetString("domain")
+	if domain, err := url.Parse(host); err == nil && domain.Host != "" {
+		host = domain.Host
+	}
+	ical := &misc.ICalEvent{
+		UID:     fmt.Sprintf("event-%d@%s", event.ID, host),
+		Summary: *event.Title,
+		Begin:   *event.TimeBegin,
+		End:     *event.TimeEnd,
+		Updated: event.UpdatedAt,
+		Status:  "CONFIRMED",
+	}
+	if *event.Status == model.EventCancelled {
+		ical.Status = "CANCELLED"
+	} else if signupStatus == model.SignupWaitlisted || signupStatus == model.SignupPending || *event.Status == model.EventPostponed {
+		ical.Status = "TENTATIVE"
+	}
+	if event.Organizer != nil {
+		ical.Description = fmt.Sprintf("%s event organized by %s", *event.Type, *event.Organizer.Nickname)
+	}
+	switch location := model.DecodeLocation(event.Location).(type) {
+	case *model.PhysicalLocation:
+		ical.Location = icalAddress(location)
+	case *model.OnlineLocation:
+		ical.Location = location.Platform + " (online)"
+		ical.URL = location.Link
+	case *model.HybridLocation:
+		// the physical location is given as the location and the online one as the URL
+		var parts []string
+		if physical := location.Physical(); physical != nil {
+			parts = append(parts, icalAddress(physical))
+		}
+		if online := location.Online(); online != nil {
+			parts = append(parts, online.Platform+" (online)")
+			ical.URL = online.Link
+		}
+		ical.Location = strings.Join(parts, " / ")
+	}
+	return ical
+}
+
+// icalAddress joins non-empty parts of a physical location into a single line
+func icalAddress(location *model.PhysicalLocation) string {
+	var parts []string
+	for _, part := range []string{location.Unit, location.Building, location.Address, location.ZipCode} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/jsonapi"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"schrodinger-box/internal/misc"
+	"schrodinger-box/internal/model"
+)
+
+/*
+ * Handlers for /event/:id/checkin actions : self check-in of attendees with codes shown by event staff
+ */
+
+// error detail returned for each rejected result of check-in
+var checkinRejections = map[string]string{
+	"invalid":       "check-in code is invalid",
+	"expired":       "check-in code has expired, please scan the latest one",
+	"wrong_event":   "check-in code is generated for another event",
+	"not_signed_up": "you do not hold a confirmed signup of this event",
+	"checked_in":    "you have already checked in",
+	"closed":        "check-in of this event is not open",
+}
+
+// the code is meant to be shown as a QR code and refreshed before it expires
+func EventCheckinCodeGet(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to get check-in code")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	event := &model.Event{}
+	if err := db.First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !requireStaffRole(ctx, db, event, user, model.AttendanceRoles, "only event staff can get check-in code") {
+		return
+	}
+	// the secret is created with the event row locked, so that staff requesting codes at the same time share one secret
+	if event.CheckinSecret == nil {
+		tx := db.Begin()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(event, event.ID).Error; err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		} else if err := event.EnsureCheckinSecret(tx); err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		} else if err := tx.Commit().Error; err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	now := time.Now()
+	code, expiresAt, err := event.CheckinCode(now)
+	if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// next code is available at the beginning of the next period
+	refreshAt := now.Truncate(model.CheckinCodePeriod).Add(model.CheckinCodePeriod)
+	ctx.JSON(http.StatusOK, map[string]map[string]string{
+		"meta": {
+			"code":       code,
+			"expires_at": expiresAt.Format(time.RFC3339),
+			"refresh_at": refreshAt.Format(time.RFC3339),
+		},
+	})
+}
+
+// every attempt is logged, the log entry is returned if the attendee is checked in
+func EventCheckinCreate(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to check in")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	checkin := &model.EventCheckin{}
+	if err := jsonapi.UnmarshalPayload(ctx.Request.Body, checkin); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "cannot unmarshal JSON of request: "+err.Error())
+		return
+	} else if checkin.Code == nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "check-in code is not provided")
+		return
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	event := &model.Event{}
+	if err := db.First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	now := time.Now()
+	result := "accepted"
+	signup := &model.EventSignup{}
+	tx := db.Begin()
+	if err := event.VerifyCheckinCode(*checkin.Code, now); err != nil {
+		result = err.Error()
+	} else if !event.CheckinOpen(now) {
+		result = "closed"
+	} else if err := tx.Where("event_id = ? AND user_id = ? AND status IN ?", event.ID, user.ID, model.ConfirmedStatuses).
+		First(signup).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		result = "not_signed_up"
+	} else if err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if err := signup.Transition(tx, model.SignupMarkAttended, nil); errors.Is(err, model.ErrSignupTransition) {
+		// the user has already checked in (the signup is attended or reviewed), or it has been changed by another request
+		// users marked as no-show can still check in when they turn up late, which is an allowed transition
+		checkin.SignupID = &signup.ID
+		result = "checked_in"
+	} else if err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else {
+		checkin.SignupID = &signup.ID
+	}
+	checkin.ID = 0
+	checkin.EventID = &event.ID
+	checkin.UserID = &user.ID
+	checkin.Result = &result
+	if err := tx.Omit("Event", "User").Create(checkin).Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if result != "accepted" {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, checkinRejections[result])
+		return
+	}
+	checkin.Code = nil
+	ctx.Status(http.StatusCreated)
+	if err := jsonapi.MarshalPayload(ctx.Writer, checkin); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// check-in log of an event for event staff, latest attempts come first
+func EventCheckinsGet(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to view check-in log")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	event := &model.Event{}
+	var checkins []*model.EventCheckin
+	if err := db.First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !requireStaffRole(ctx, db, event, user, model.AttendanceRoles, "only event staff can view check-in log") {
+		return
+	} else if err := db.Preload("User").Where("event_id = ?", event.ID).Order("id desc").Find(&checkins).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.Status(http.StatusOK)
+	if err := jsonapi.MarshalPayload(ctx.Writer, checkins); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
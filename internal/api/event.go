@@ -1,10 +1,12 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"reflect"
 	"strconv"
@@ -17,6 +19,7 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 
+	"schrodinger-box/internal/external"
 	"schrodinger-box/internal/misc"
 	"schrodinger-box/internal/model"
 )
@@ -33,8 +36,6 @@ func EventCreate(ctx *gin.Context) {
 		user = userInterface.(*model.User)
 	}
 	event := &model.Event{}
-	physicalLocation := &model.PhysicalLocation{}
-	onlineLocation := &model.OnlineLocation{}
 	if err := jsonapi.UnmarshalPayload(ctx.Request.Body, event); err != nil {
 		misc.ReturnStandardError(ctx, http.StatusBadRequest, "cannot unmarshal JSON of request: "+err.Error())
 		return
@@ -45,54 +46,81 @@ func EventCreate(ctx *gin.Context) {
 		reflect.ValueOf(event.Location).IsNil() {
 		misc.ReturnStandardError(ctx, http.StatusBadRequest, "not all fields required are provided")
 		return
-	} else if eventType, exists := event.Location.(map[string]interface{})["type"]; !exists || (eventType != "physical" && eventType != "online") {
-		misc.ReturnStandardError(ctx, http.StatusBadRequest, "illegal event type")
+	} else if detail := validateLocation(event.Location); detail != "" {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, detail)
 		return
-	} else if eventType == "physical" &&
-		(mapstructure.Decode(event.Location, physicalLocation) != nil ||
-			physicalLocation.Address == "" ||
-			physicalLocation.ZipCode == "") {
-		misc.ReturnStandardError(ctx, http.StatusBadRequest, "illegal physical location")
+	} else if !event.IsHybrid() && hasModeCapacity(event) {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "capacities of attendance modes can only be set for hybrid events")
 		return
-	} else if eventType == "online" &&
-		(mapstructure.Decode(event.Location, onlineLocation) != nil ||
-			onlineLocation.Platform == "" ||
-			onlineLocation.Link == "") {
-		misc.ReturnStandardError(ctx, http.StatusBadRequest, "illegal online location")
+	} else if detail := validateDeadlines(event); detail != "" {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, detail)
+		return
+	} else if event.LotteryDrawAt != nil && !event.LotteryDrawAt.After(time.Now()) {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "lottery cannot be drawn in the past")
+		return
+	} else if detail := validateLottery(event); detail != "" {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, detail)
+		return
+	} else if event.GuestLimit() > model.MaxGuestsLimit {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, fmt.Sprintf("at most %d guests can be allowed per signup", model.MaxGuestsLimit))
 		return
 	}
+	if questions, err := model.DecodeQuestions(event.Questions); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, err.Error())
+		return
+	} else {
+		event.Questions = questions
+	}
+	if event.PublishStatus != nil && *event.PublishStatus != model.EventDraft && *event.PublishStatus != model.EventPublished {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "illegal publish status")
+		return
+	} else if event.Visibility != nil && !isEventVisibility(*event.Visibility) {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "illegal event visibility")
+		return
+	}
+	geocodeLocation(event.Location)
+	// new events are always scheduled
+	event.Status = nil
+	event.CancelReason = nil
+	event.LotteryDrawnAt = nil
+	event.LotterySeed = nil
+	// events with a publishing time in the future are kept as drafts until then
+	if event.PublishAt != nil && event.PublishAt.After(time.Now()) {
+		draft := model.EventDraft
+		event.PublishStatus = &draft
+	}
+	event.PublishedAt = nil
 	event.OrganizerID = &user.ID
 	event.Organizer = user
 	images := event.Images
 	db := ctx.MustGet("DB").(*gorm.DB)
+	if event.Tags != nil {
+		tags, status, err := resolveTags(db, event.Tags)
+		if err != nil {
+			misc.ReturnStandardError(ctx, status, err.Error())
+			return
+		}
+		event.Tags = tags
+	}
 	tx := db.Begin()
 	// we must omit images as inspection has to be gone through before they are linked
+	// tags have been resolved from the vocabulary so only the links to them are created
 	if err := tx.Omit("Images").Save(event).Error; err != nil {
+		tx.Rollback()
 		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
 		return
 	}
 	// link images to this event
-	eventString := "events"
-	for _, image := range images {
-		if image.ID <= 0 {
-			misc.ReturnStandardError(ctx, http.StatusBadRequest, "invalid image file ID")
-		} else if err := db.Where(image).Find(image).Error; errors.Is(err, gorm.ErrRecordNotFound) {
-			misc.ReturnStandardError(ctx, http.StatusNotFound, "image specified not found")
-		} else if err != nil {
-			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
-		} else if *image.Status != "active" || *image.Type != "images" {
-			misc.ReturnStandardError(ctx, http.StatusBadRequest, "image specified is not active or is not an image")
-		} else if image.LinkType != nil {
-			misc.ReturnStandardError(ctx, http.StatusBadRequest, "image has been linked to some other resource object")
-		} else if err := db.Model(&image).Updates(model.File{LinkID: &event.ID, LinkType: &eventString}).Error; err != nil {
-			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
-		} else {
-			continue
-		}
+	if !linkImages(ctx, tx, event.ID, "events", images) {
 		// roll back the action of event creation if any of the images cannot pass integrity check
 		tx.Rollback()
 		return
 	}
+	if err := event.ScheduleReminders(tx); err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
 	if err := tx.Commit().Error; err != nil {
 		tx.Rollback()
 		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
@@ -105,18 +133,202 @@ func EventCreate(ctx *gin.Context) {
 	}
 }
 
+func EventUpdate(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to update event")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	eventRequest := &model.Event{}
+	payload, err := ioutil.ReadAll(ctx.Request.Body)
+	if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "cannot read request: "+err.Error())
+		return
+	} else if err := jsonapi.UnmarshalPayload(bytes.NewReader(payload), eventRequest); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "cannot unmarshal JSON of request: "+err.Error())
+		return
+	} else if eventRequest.ID <= 0 {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "invalid event ID")
+		return
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	event := &model.Event{}
+	if err := db.Preload(clause.Associations).First(event, eventRequest.ID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !requireStaffRole(ctx, db, event, user, model.ManagerRoles, "you can only update event organized by your own") {
+		return
+	} else if *event.Status == model.EventCancelled {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "cancelled event cannot be updated")
+		return
+	}
+	if eventRequest.PublishStatus != nil && *eventRequest.PublishStatus != *event.PublishStatus {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "drafts can only be published through the publish action")
+		return
+	} else if eventRequest.PublishAt != nil && event.IsPublished() {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "publishing time can only be set for drafts")
+		return
+	} else if eventRequest.Visibility != nil && !isEventVisibility(*eventRequest.Visibility) {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "illegal event visibility")
+		return
+	} else if (eventRequest.LotteryDrawAt != nil || eventRequest.LotteryWeighted != nil) && event.LotteryDrawnAt != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "lottery of this event has been drawn")
+		return
+	} else if eventRequest.LotteryDrawAt != nil && !eventRequest.LotteryDrawAt.After(time.Now()) {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "lottery cannot be drawn in the past")
+		return
+	}
+	if eventRequest.Status != nil {
+		if *eventRequest.Status == model.EventCancelled {
+			misc.ReturnStandardError(ctx, http.StatusBadRequest, "event can only be cancelled through the cancel action")
+			return
+		} else if !isEventStatus(*eventRequest.Status) {
+			misc.ReturnStandardError(ctx, http.StatusBadRequest, "illegal event status")
+			return
+		}
+	}
+	if eventRequest.Questions != nil {
+		// an empty array removes all questions
+		if questions, err := model.DecodeQuestions(eventRequest.Questions); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusBadRequest, err.Error())
+			return
+		} else {
+			eventRequest.Questions = questions
+		}
+	}
+	if eventRequest.Location != nil {
+		if detail := validateLocation(eventRequest.Location); detail != "" {
+			misc.ReturnStandardError(ctx, http.StatusBadRequest, detail)
+			return
+		}
+		geocodeLocation(eventRequest.Location)
+	}
+	changes := applyEventChanges(event, eventRequest)
+	// deadlines set before are cleared with null so that the defaults apply again
+	if attributeCleared(payload, "signup_open_at") {
+		event.SignupOpenAt = nil
+	}
+	if attributeCleared(payload, "signup_close_at") {
+		event.SignupCloseAt = nil
+	}
+	if attributeCleared(payload, "withdraw_by") && event.WithdrawBy != nil {
+		changes.lines = append(changes.lines, fmt.Sprintf("signups can be withdrawn until %s", event.TimeBegin.Format(model.NotificationTimeFormat)))
+		event.WithdrawBy = nil
+	}
+	if event.TimeEnd.Before(*event.TimeBegin) {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "event cannot end before it begins")
+		return
+	} else if !event.IsHybrid() && hasModeCapacity(event) {
+		// capacities of attendance modes have to be cleared with 0 when an event is no longer hybrid
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "capacities of attendance modes can only be set for hybrid events")
+		return
+	} else if detail := validateDeadlines(event); detail != "" {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, detail)
+		return
+	} else if detail := validateLottery(event); detail != "" {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, detail)
+		return
+	} else if event.GuestLimit() > model.MaxGuestsLimit {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, fmt.Sprintf("at most %d guests can be allowed per signup", model.MaxGuestsLimit))
+		return
+	}
+	var tags []*model.Tag
+	if relationshipGiven(payload, "tags") {
+		// tags are cleared if an empty array is given
+		var status int
+		if tags, status, err = resolveTags(db, eventRequest.Tags); err != nil {
+			misc.ReturnStandardError(ctx, status, err.Error())
+			return
+		}
+	}
+	tx := db.Begin()
+	if eventRequest.Images != nil {
+		if changed, ok := replaceImages(ctx, tx, event.ID, "events", event.Images, eventRequest.Images); !ok {
+			tx.Rollback()
+			return
+		} else if changed {
+			changes.lines = append(changes.lines, "images have been updated")
+		}
+	}
+	if tags != nil {
+		if err := tx.Model(event).Association("Tags").Replace(tags); err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if err := commitEventChanges(tx, event, changes); err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// reload the event to reflect linkage changes of images
+	if err := db.Preload(clause.Associations).Preload("Series.Images").First(event, event.ID).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	event.LoadSignups(db)
+	event.HideReviewsFrom(user)
+	ctx.Status(http.StatusOK)
+	if err := jsonapi.MarshalPayload(ctx.Writer, event); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+}
+
 func EventGet(ctx *gin.Context) {
 	id := ctx.Param("id")
 	event := &model.Event{}
 	db := ctx.MustGet("DB").(*gorm.DB)
-	if err := db.Preload(clause.Associations).First(event, id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+	if err := db.Preload(clause.Associations).Preload("Series.Images").Preload("Staff.User").First(event, id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
 		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
 		return
 	} else if err != nil {
 		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
 		return
+	} else if visible, err := event.VisibleTo(db, optionalUser(ctx), ctx.Query("invite")); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !visible {
+		// drafts are hidden as if they do not exist
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
 	}
 	event.LoadSignups(db)
+	// reviews are served through /event/:id/reviews, which respects anonymity and hiding by admins
+	event.HideReviewsFrom(optionalUser(ctx))
+	// answers to registration questions and names of guests are only shown to organizers
+	if user := optionalUser(ctx); user != nil {
+		if isManager, err := event.HasStaffRole(db, user.ID, model.ManagerRoles); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		} else if isManager {
+			for _, signup := range event.EventSignups {
+				if err := signup.LoadAnswers(); err != nil {
+					misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+					return
+				} else if err := signup.LoadGuests(); err != nil {
+					misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+					return
+				}
+			}
+		}
+	}
+	// links of online events are only shown to staff and users signed up
+	if err := event.HideLocationFrom(db, optionalUser(ctx)); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
 	ctx.Status(http.StatusOK)
 	if err := jsonapi.MarshalPayload(ctx.Writer, event); err != nil {
 		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
@@ -139,22 +351,488 @@ func EventDelete(ctx *gin.Context) {
 		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
 	} else if err != nil {
 		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
-	} else if *event.OrganizerID != user.ID {
-		misc.ReturnStandardError(ctx, http.StatusForbidden, "you can only delete event organized by your own")
+	} else if !requireStaffRole(ctx, db, event, user, []string{model.StaffOwner}, "only the owner can delete an event") {
+		return
+	} else if len(event.EventSignups) != 0 {
+		// signup records would be lost with the event, users have to be told through cancellation instead
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "event with signups cannot be deleted, please cancel it instead")
+	} else if err := deleteEvent(db, event); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
 	} else {
-		// release file linkages
-		for _, image := range event.Images {
-			if err := db.Model(image).Updates(map[string]interface{}{"link_type": nil, "link_id": nil}).Error; err != nil {
-				misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
-				return
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+// deleteEvent releases images linked to the event, cancels its reminders and deletes it
+func deleteEvent(db *gorm.DB, event *model.Event) error {
+	if err := releaseImages(db, event.Images); err != nil {
+		return err
+	}
+	if err := event.CancelReminders(db); err != nil {
+		return err
+	}
+	return db.Delete(event).Error
+}
+
+// cancel an event with an optional reason, the request body is either empty or an event with attribute cancel_reason
+// cancelled events remain visible to users signed up
+func EventCancel(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to cancel event")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	eventRequest := &model.Event{}
+	if ctx.Request.ContentLength != 0 {
+		if err := jsonapi.UnmarshalPayload(ctx.Request.Body, eventRequest); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusBadRequest, "cannot unmarshal JSON of request: "+err.Error())
+			return
+		}
+	}
+	event := &model.Event{}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	if err := db.First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !requireStaffRole(ctx, db, event, user, model.ManagerRoles, "you can only cancel event organized by your own") {
+		return
+	} else if *event.Status == model.EventCancelled {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "event has already been cancelled")
+		return
+	}
+	tx := db.Begin()
+	if err := event.Cancel(tx, eventRequest.CancelReason); err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := db.Preload(clause.Associations).Preload("Series.Images").First(event, event.ID).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	event.LoadSignups(db)
+	event.HideReviewsFrom(user)
+	ctx.Status(http.StatusOK)
+	if err := jsonapi.MarshalPayload(ctx.Writer, event); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// isEventStatus checks whether status is one of model.EventStatuses
+func isEventStatus(status string) bool {
+	for _, eventStatus := range model.EventStatuses {
+		if status == eventStatus {
+			return true
+		}
+	}
+	return false
+}
+
+func isAttendanceMode(mode string) bool {
+	for _, attendanceMode := range model.AttendanceModes {
+		if mode == attendanceMode {
+			return true
+		}
+	}
+	return false
+}
+
+// hasModeCapacity checks whether a limit is set on any attendance mode of the event
+func hasModeCapacity(event *model.Event) bool {
+	return (event.CapacityInPerson != nil && *event.CapacityInPerson != 0) ||
+		(event.CapacityOnline != nil && *event.CapacityOnline != 0)
+}
+
+func isEventVisibility(visibility string) bool {
+	for _, eventVisibility := range model.EventVisibilities {
+		if visibility == eventVisibility {
+			return true
+		}
+	}
+	return false
+}
+
+// eventChanges records what has been changed by applyEventChanges
+type eventChanges struct {
+	// a human-readable line for each change, these are sent to users signed up to the event
+	lines    []string
+	time     bool
+	capacity bool
+	status   bool
+}
+
+// applyEventChanges copies fields provided in the request to the event after comparing old and new values
+// the request must have been validated beforehand, nothing is written to the database here
+func applyEventChanges(event *model.Event, request *model.Event) *eventChanges {
+	changes := &eventChanges{}
+	if request.Title != nil && *request.Title != *event.Title {
+		changes.lines = append(changes.lines, fmt.Sprintf("title: %s -> %s", *event.Title, *request.Title))
+		event.Title = request.Title
+	}
+	if request.TimeBegin != nil && !request.TimeBegin.Equal(*event.TimeBegin) {
+		changes.lines = append(changes.lines, fmt.Sprintf("begin time: %s -> %s",
+			event.TimeBegin.Format(model.NotificationTimeFormat), request.TimeBegin.Format(model.NotificationTimeFormat)))
+		event.TimeBegin = request.TimeBegin
+		changes.time = true
+	}
+	if request.TimeEnd != nil && !request.TimeEnd.Equal(*event.TimeEnd) {
+		changes.lines = append(changes.lines, fmt.Sprintf("end time: %s -> %s",
+			event.TimeEnd.Format(model.NotificationTimeFormat), request.TimeEnd.Format(model.NotificationTimeFormat)))
+		event.TimeEnd = request.TimeEnd
+	}
+	if request.Type != nil && *request.Type != *event.Type {
+		changes.lines = append(changes.lines, fmt.Sprintf("type: %s -> %s", *event.Type, *request.Type))
+		event.Type = request.Type
+	}
+	if request.Location != nil {
+		oldLocation, _ := json.Marshal(event.Location)
+		newLocation, _ := json.Marshal(request.Location)
+		if string(oldLocation) != string(newLocation) {
+			changes.lines = append(changes.lines, "location has been changed")
+			event.Location = request.Location
+		}
+	}
+	if request.Capacity != nil && (event.Capacity == nil || *request.Capacity != *event.Capacity) {
+		event.Capacity = request.Capacity
+		changes.capacity = true
+	}
+	if request.CapacityInPerson != nil && (event.CapacityInPerson == nil || *request.CapacityInPerson != *event.CapacityInPerson) {
+		event.CapacityInPerson = request.CapacityInPerson
+		changes.capacity = true
+	}
+	if request.CapacityOnline != nil && (event.CapacityOnline == nil || *request.CapacityOnline != *event.CapacityOnline) {
+		event.CapacityOnline = request.CapacityOnline
+		changes.capacity = true
+	}
+	if request.MaxGuests != nil {
+		// guests of existing signups are kept when the limit is lowered
+		event.MaxGuests = request.MaxGuests
+	}
+	if request.PublishAt != nil {
+		event.PublishAt = request.PublishAt
+	}
+	if request.SignupOpenAt != nil {
+		event.SignupOpenAt = request.SignupOpenAt
+	}
+	if request.SignupCloseAt != nil {
+		event.SignupCloseAt = request.SignupCloseAt
+	}
+	if request.WithdrawBy != nil && (event.WithdrawBy == nil || !request.WithdrawBy.Equal(*event.WithdrawBy)) {
+		changes.lines = append(changes.lines, fmt.Sprintf("signups can be withdrawn until %s", request.WithdrawBy.Format(model.NotificationTimeFormat)))
+		event.WithdrawBy = request.WithdrawBy
+	}
+	if request.Questions != nil {
+		event.Questions = request.Questions
+	}
+	if request.Visibility != nil {
+		event.Visibility = request.Visibility
+	}
+	if request.LotteryDrawAt != nil {
+		event.LotteryDrawAt = request.LotteryDrawAt
+	}
+	if request.LotteryWeighted != nil {
+		event.LotteryWeighted = request.LotteryWeighted
+	}
+	if request.RequiresApproval != nil {
+		// signups pending when approval is no longer required are still to be approved or rejected
+		event.RequiresApproval = request.RequiresApproval
+	}
+	if request.Status != nil && *request.Status != *event.Status {
+		changes.lines = append(changes.lines, fmt.Sprintf("status: %s -> %s", *event.Status, *request.Status))
+		event.Status = request.Status
+		changes.status = true
+	}
+	return changes
+}
+
+// commitEventChanges saves an event changed by applyEventChanges and carries out the follow-up actions
+// reminders are rescheduled, waitlist is promoted and users signed up are notified where necessary
+func commitEventChanges(tx *gorm.DB, event *model.Event, changes *eventChanges) error {
+	if err := tx.Omit(clause.Associations).Save(event).Error; err != nil {
+		return err
+	}
+	if changes.time || changes.status {
+		// reminders have to be rescheduled as the begin time has been changed
+		// they are only sent for events taking place at the time scheduled
+		if *event.Status == model.EventScheduled {
+			if err := event.ScheduleReminders(tx); err != nil {
+				return err
 			}
+		} else if err := event.CancelReminders(tx); err != nil {
+			return err
 		}
-		if err := db.Delete(&event).Error; err != nil {
+	}
+	if changes.capacity {
+		// more places may be available now, waitlisted users are promoted before others are notified
+		if err := event.PromoteWaitlist(tx); err != nil {
+			return err
+		}
+	}
+	if len(changes.lines) != 0 {
+		text := fmt.Sprintf("Event \"%s\" has been updated by its organizer:\n%s", *event.Title, strings.Join(changes.lines, "\n"))
+		return event.NotifySignups(tx, "EventUpdate", text, time.Now())
+	}
+	return nil
+}
+
+// validateLocation checks the location object sent by the client
+// an empty string is returned if the location is valid, otherwise the error detail is returned
+func validateLocation(location interface{}) string {
+	physicalLocation := &model.PhysicalLocation{}
+	onlineLocation := &model.OnlineLocation{}
+	locationMap, ok := location.(map[string]interface{})
+	if !ok {
+		return "illegal event location"
+	} else if eventType, exists := locationMap["type"]; !exists || (eventType != "physical" && eventType != "online" && eventType != "hybrid") {
+		return "illegal event type"
+	} else if eventType == "hybrid" {
+		return validateHybridLocation(locationMap["locations"])
+	} else if eventType == "physical" &&
+		(mapstructure.Decode(location, physicalLocation) != nil ||
+			physicalLocation.Address == "" ||
+			physicalLocation.ZipCode == "") {
+		return "illegal physical location"
+	} else if eventType == "physical" &&
+		((physicalLocation.Latitude == nil) != (physicalLocation.Longitude == nil) ||
+			physicalLocation.Latitude != nil && !misc.ValidCoordinates(*physicalLocation.Latitude, *physicalLocation.Longitude)) {
+		return "illegal coordinates of physical location"
+	} else if eventType == "online" &&
+		(mapstructure.Decode(location, onlineLocation) != nil ||
+			onlineLocation.Platform == "" ||
+			onlineLocation.Link == "") {
+		return "illegal online location"
+	}
+	return ""
+}
+
+// attributeCleared checks whether an attribute is given as null in a JSON:API payload, which jsonapi cannot tell from omission
+func attributeCleared(payload []byte, attribute string) bool {
+	var document struct {
+		Data struct {
+			Attributes map[string]json.RawMessage `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &document); err != nil {
+		return false
+	}
+	value, ok := document.Data.Attributes[attribute]
+	return ok && string(value) == "null"
+}
+
+// validateDeadlines checks signup and withdrawal deadlines of an event against each other and the time of the event
+// an empty string is returned if they are valid, otherwise the error detail is returned
+func validateDeadlines(event *model.Event) string {
+	if event.SignupOpenAt != nil && !event.SignupOpenAt.Before(event.SignupClosesAt()) {
+		return "signup must open before it closes"
+	} else if event.SignupCloseAt != nil && event.SignupCloseAt.After(*event.TimeEnd) {
+		return "signup cannot close after the event ends"
+	} else if event.WithdrawBy != nil && event.WithdrawBy.After(*event.TimeEnd) {
+		return "withdrawal deadline cannot be after the event ends"
+	}
+	return ""
+}
+
+// validateLottery checks the lottery settings of an event, an empty string is returned if they are valid
+func validateLottery(event *model.Event) string {
+	if !event.IsLottery() {
+		return ""
+	} else if event.NeedsApproval() {
+		return "places of events requiring approval cannot be allocated by lottery"
+	} else if event.LotteryDrawnAt == nil && !event.LotteryDrawAt.Before(*event.TimeBegin) {
+		return "lottery must be drawn before the event begins"
+	}
+	return ""
+}
+
+// validateHybridLocation checks locations of a hybrid event, which must include both physical and online ones
+// every location is tagged with its role and exactly one of them is the primary location
+func validateHybridLocation(locations interface{}) string {
+	parts, ok := locations.([]interface{})
+	if !ok || len(parts) < 2 || len(parts) > model.MaxHybridLocations {
+		return fmt.Sprintf("a hybrid event must have 2 to %d locations", model.MaxHybridLocations)
+	}
+	primaries := 0
+	types := make(map[interface{}]bool)
+	for _, part := range parts {
+		partMap, ok := part.(map[string]interface{})
+		if !ok || partMap["type"] == "hybrid" {
+			return "illegal location of hybrid event"
+		} else if detail := validateLocation(part); detail != "" {
+			return detail
+		}
+		switch partMap["role"] {
+		case model.LocationPrimary:
+			primaries++
+		case model.LocationSecondary:
+		default:
+			return "every location of a hybrid event must be tagged as primary or secondary"
+		}
+		types[partMap["type"]] = true
+	}
+	if primaries != 1 {
+		return "a hybrid event must have exactly one primary location"
+	} else if !types["physical"] || !types["online"] {
+		return "a hybrid event must have both physical and online locations"
+	}
+	return ""
+}
+
+// geocodeLocation fills in coordinates of a physical location which are not given by the client
+// the location is saved without coordinates if it cannot be geocoded
+func geocodeLocation(location interface{}) {
+	locationMap, ok := location.(map[string]interface{})
+	if !ok || external.ActiveGeocoder == nil {
+		return
+	} else if parts, ok := locationMap["locations"].([]interface{}); ok && locationMap["type"] == "hybrid" {
+		for _, part := range parts {
+			geocodeLocation(part)
+		}
+		return
+	}
+	physicalLocation, ok := model.DecodeLocation(locationMap).(*model.PhysicalLocation)
+	if !ok || physicalLocation.Latitude != nil {
+		return
+	}
+	if latitude, longitude, err := external.ActiveGeocoder.Geocode(physicalLocation); err == nil {
+		locationMap["latitude"] = latitude
+		locationMap["longitude"] = longitude
+	} else if !errors.Is(err, external.ErrLocationNotFound) {
+		fmt.Fprintf(gin.DefaultWriter, "[Schrodinger's Box] Cannot geocode location - %s\n", err.Error())
+	}
+}
+
+// linkImages links uploaded image files to a resource object (e.g. linkType="events") after checking their integrity
+// error response is written and false is returned if any of the images cannot be linked
+func linkImages(ctx *gin.Context, tx *gorm.DB, linkID uint, linkType string, images []*model.File) bool {
+	for _, image := range images {
+		if image.ID <= 0 {
+			misc.ReturnStandardError(ctx, http.StatusBadRequest, "invalid image file ID")
+		} else if err := tx.Where(image).First(image).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			misc.ReturnStandardError(ctx, http.StatusNotFound, "image specified not found")
+		} else if err != nil {
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		} else if *image.Status != "active" || *image.Type != "images" {
+			misc.ReturnStandardError(ctx, http.StatusBadRequest, "image specified is not active or is not an image")
+		} else if image.LinkType != nil {
+			misc.ReturnStandardError(ctx, http.StatusBadRequest, "image has been linked to some other resource object")
+		} else if err := tx.Model(image).Updates(model.File{LinkID: &linkID, LinkType: &linkType}).Error; err != nil {
 			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
 		} else {
-			ctx.Status(http.StatusNoContent)
+			continue
 		}
+		return false
 	}
+	return true
+}
+
+// replaceImages releases images no longer in use by a resource object and links the newly added ones
+// whether the images are changed is returned, error response is written and ok is false if it fails
+func replaceImages(ctx *gin.Context, tx *gorm.DB, linkID uint, linkType string, current []*model.File, requested []*model.File) (changed bool, ok bool) {
+	keep := make(map[uint]struct{})
+	for _, image := range requested {
+		keep[image.ID] = struct{}{}
+	}
+	linked := make(map[uint]struct{})
+	for _, image := range current {
+		linked[image.ID] = struct{}{}
+		if _, ok := keep[image.ID]; ok {
+			continue
+		}
+		changed = true
+		if err := releaseImages(tx, []*model.File{image}); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return false, false
+		}
+	}
+	var added []*model.File
+	for _, image := range requested {
+		if _, ok := linked[image.ID]; !ok {
+			added = append(added, image)
+		}
+	}
+	if !linkImages(ctx, tx, linkID, linkType, added) {
+		return false, false
+	}
+	return changed || len(added) != 0, true
+}
+
+// releaseImages unlinks images from the resource object they are linked to
+func releaseImages(db *gorm.DB, images []*model.File) error {
+	for _, image := range images {
+		if err := db.Model(image).Updates(map[string]interface{}{"link_type": nil, "link_id": nil}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drafts are published immediately regardless of their publishing time
+func EventPublish(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to publish event")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	event := &model.Event{}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	if err := db.First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !requireStaffRole(ctx, db, event, user, model.ManagerRoles, "you can only publish event organized by your own") {
+		return
+	} else if event.IsPublished() {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "event has already been published")
+		return
+	}
+	tx := db.Begin()
+	if err := event.Publish(tx, time.Now()); errors.Is(err, model.ErrEventPublished) {
+		// the event has been published by the cron job or another request in the meantime
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, err.Error())
+		return
+	} else if err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := db.Preload(clause.Associations).Preload("Series.Images").First(event, event.ID).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	event.LoadSignups(db)
+	event.HideReviewsFrom(user)
+	ctx.Status(http.StatusOK)
+	if err := jsonapi.MarshalPayload(ctx.Writer, event); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// optionalUser returns the user making the request, nil is returned if the request is anonymous
+func optionalUser(ctx *gin.Context) *model.User {
+	if userInterface, exists := ctx.Get("User"); exists {
+		return userInterface.(*model.User)
+	}
+	return nil
 }
 
 /*
@@ -179,22 +857,25 @@ func EventSignupCreate(ctx *gin.Context) {
 	}
 	db := ctx.MustGet("DB").(*gorm.DB)
 	event := model.Event{}
-	if err := db.Where(eventSignup.Event).First(&event).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+	// the event row is locked so that concurrent signups cannot exceed its capacity
+	tx := db.Begin()
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&event, eventSignup.Event.ID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		tx.Rollback()
 		misc.ReturnStandardError(ctx, http.StatusNotFound, "specified event cannot be found")
 		return
 	} else if err != nil {
+		tx.Rollback()
 		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
 		return
 	}
-	if *event.OrganizerID == user.ID {
-		misc.ReturnStandardError(ctx, http.StatusBadRequest, "you cannot signup events organized by yourself")
-		return
-	}
-	eventSignup.EventID = &event.ID
-	eventSignup.Event = &event
-	eventSignup.UserID = &user.ID
-	eventSignup.User = user
-	if err := db.Save(eventSignup).Error; err != nil {
+	if status, err := createSignup(tx, &event, user, eventSignup); err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, status, err.Error())
+	} else if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else if err := event.HideLocationFrom(db, user); err != nil {
+		// waitlisted users cannot see the link yet
 		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
 	} else {
 		ctx.Status(http.StatusCreated)
@@ -206,7 +887,7 @@ func EventSignupCreate(ctx *gin.Context) {
 
 func EventSignupUpdate(ctx *gin.Context) {
 	// there are two situations for an event signup record to be updated
-	// 1. the Organizer marks the user as attended (user.ID == signup.Event.OrganizerID)
+	// 1. the event staff (owner, co-organizer or checker) marks the user as attended
 	// 2. the Participant leaves review to the event (user.ID == signup.UserID)
 	var user *model.User
 	if userInterface, exists := ctx.Get("User"); !exists {
@@ -225,28 +906,45 @@ func EventSignupUpdate(ctx *gin.Context) {
 	}
 	db := ctx.MustGet("DB").(*gorm.DB)
 	signup := &model.EventSignup{}
-	reviewedString := "reviewed"
-	if err := db.Preload(clause.Associations).Find(&signup, signupRequest.ID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+	anonymous := signupRequest.ReviewAnonymous != nil && *signupRequest.ReviewAnonymous
+	now := time.Now()
+	if err := db.Preload(clause.Associations).First(signup, signupRequest.ID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
 		misc.ReturnStandardError(ctx, http.StatusNotFound, "specified event_signup cannot be found")
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
 	} else if user.ID == *signup.UserID {
-		if *signup.Status == "created" {
-			misc.ReturnStandardError(ctx, http.StatusForbidden, "you cannot leave review before you attend the event")
-		} else if *signup.Status == "reviewed" {
-			misc.ReturnStandardError(ctx, http.StatusForbidden, "you have already reviewed this event before")
+		if *signup.Status == model.SignupReviewed {
+			misc.ReturnStandardError(ctx, http.StatusConflict, "you have already reviewed this event before")
+		} else if !model.CanTransition(*signup.Status, model.SignupReview) {
+			misc.ReturnStandardError(ctx, http.StatusConflict, "you cannot leave review before you attend the event")
 		} else if signupRequest.ReviewScore == nil || signupRequest.ReviewText == nil {
 			misc.ReturnStandardError(ctx, http.StatusBadRequest, "you must provide both score and text comment")
-		} else if err := db.Model(signup).Updates(model.EventSignup{ReviewText: signupRequest.ReviewText, ReviewScore: signupRequest.ReviewScore, Status: &reviewedString}).Error; err != nil {
+		} else if *signupRequest.ReviewScore < 1 || *signupRequest.ReviewScore > model.MaxReviewScore {
+			misc.ReturnStandardError(ctx, http.StatusBadRequest, fmt.Sprintf("score must be between 1 and %d", model.MaxReviewScore))
+		} else if err := signup.Transition(db, model.SignupReview, map[string]interface{}{
+			"review_text":      *signupRequest.ReviewText,
+			"review_score":     *signupRequest.ReviewScore,
+			"review_anonymous": anonymous,
+			"reviewed_at":      now,
+		}); errors.Is(err, model.ErrSignupTransition) {
+			misc.ReturnStandardError(ctx, http.StatusConflict, err.Error())
+		} else if err != nil {
 			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
 		} else {
+			signup.ReviewText, signup.ReviewScore, signup.ReviewAnonymous, signup.ReviewedAt = signupRequest.ReviewText, signupRequest.ReviewScore, &anonymous, &now
 			ctx.Status(http.StatusOK)
 			if err := jsonapi.MarshalPayload(ctx.Writer, signup); err != nil {
 				misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
 			}
 		}
-	} else if user.ID == *signup.Event.OrganizerID {
-		if *signup.Status != "created" {
-			misc.ReturnStandardError(ctx, http.StatusForbidden, "the user's attendance has been marked")
-		} else if err := db.Model(signup).Update("status", "attended").Error; err != nil {
+	} else if isStaff, err := signup.Event.HasStaffRole(db, user.ID, model.AttendanceRoles); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else if isStaff {
+		if *signup.Status == model.SignupAttended || *signup.Status == model.SignupReviewed {
+			misc.ReturnStandardError(ctx, http.StatusConflict, "the user's attendance has been marked")
+		} else if err := signup.Transition(db, model.SignupMarkAttended, nil); errors.Is(err, model.ErrSignupTransition) {
+			misc.ReturnStandardError(ctx, http.StatusConflict, err.Error())
+		} else if err != nil {
 			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
 		} else {
 			ctx.Status(http.StatusOK)
@@ -255,7 +953,7 @@ func EventSignupUpdate(ctx *gin.Context) {
 			}
 		}
 	} else {
-		misc.ReturnStandardError(ctx, http.StatusForbidden, "you are neither event organizer nor participant of this signup record")
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you are neither event staff nor participant of this signup record")
 	}
 }
 
@@ -270,123 +968,325 @@ func EventSignupDelete(ctx *gin.Context) {
 	id := ctx.Param("id")
 	eventSignup := &model.EventSignup{}
 	db := ctx.MustGet("DB").(*gorm.DB)
-	if err := db.First(eventSignup, id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+	if err := db.Preload("Event").First(eventSignup, id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
 		misc.ReturnStandardError(ctx, http.StatusNotFound, "event signup record does not exist")
 	} else if err != nil {
 		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
 	} else if *eventSignup.UserID != user.ID {
 		misc.ReturnStandardError(ctx, http.StatusForbidden, "you can only delete your own signup record")
-	} else if err := db.Delete(&eventSignup).Error; err != nil {
-		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else if err := eventSignup.Event.CheckWithdrawOpen(time.Now()); err != nil && *eventSignup.Status == model.SignupCreated {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, err.Error())
 	} else {
-		ctx.Status(http.StatusNoContent)
+		tx := db.Begin()
+		if err := withdrawSignup(tx, eventSignup); errors.Is(err, model.ErrSignupTransition) {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusConflict, "only signups which have not been attended can be withdrawn")
+		} else if err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		} else if err := tx.Commit().Error; err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		} else {
+			ctx.Status(http.StatusNoContent)
+		}
 	}
 }
 
+// createSignup saves a signup record of the user to an event, which has to be locked in the transaction
+// HTTP status code is returned together with the error if the signup cannot be created
+func createSignup(tx *gorm.DB, event *model.Event, user *model.User, eventSignup *model.EventSignup) (int, error) {
+	// only these attributes are taken from the request, the others (status, reviews, decisions, lottery results and
+	// transfers) are owned by the server and must not be set by the user signing up
+	*eventSignup = model.EventSignup{
+		InviteCode:     eventSignup.InviteCode,
+		AttendanceMode: eventSignup.AttendanceMode,
+		Answers:        eventSignup.Answers,
+		Guests:         eventSignup.Guests,
+	}
+	if role, err := event.StaffRole(tx, user.ID); err != nil {
+		return http.StatusInternalServerError, err
+	} else if role != "" {
+		return http.StatusBadRequest, errors.New("you cannot signup events organized by yourself")
+	} else if !event.IsPublished() {
+		return http.StatusNotFound, errors.New("specified event cannot be found")
+	} else if !event.IsActive() {
+		return http.StatusBadRequest, fmt.Errorf("you cannot signup events which have been %s", *event.Status)
+	}
+	// a user who has withdrawn can join again with a new signup, the one withdrawn is kept as history
+	if active, err := event.ActiveSignup(tx, user.ID); err != nil {
+		return http.StatusInternalServerError, err
+	} else if active != nil && *active.Status == model.SignupRejected {
+		return http.StatusConflict, model.ErrSignupRejected
+	} else if active != nil {
+		return http.StatusConflict, model.ErrSignupExists
+	}
+	// invite-only events can only be joined with an invite code, they are hidden from others as if they do not exist
+	var invite *model.EventInvite
+	if !event.IsOpen() {
+		var err error
+		if eventSignup.InviteCode == nil {
+			return http.StatusNotFound, errors.New("specified event cannot be found")
+		} else if invite, err = event.FindInvite(tx, *eventSignup.InviteCode, time.Now()); errors.Is(err, model.ErrInviteInvalid) {
+			return http.StatusNotFound, errors.New("specified event cannot be found")
+		} else if errors.Is(err, model.ErrInviteExpired) || errors.Is(err, model.ErrInviteExhausted) {
+			return http.StatusBadRequest, err
+		} else if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	if err := event.CheckSignupOpen(time.Now()); err != nil {
+		return http.StatusBadRequest, err
+	}
+	// users attend hybrid events either in person or online, each mode may have its own capacity
+	if event.IsHybrid() {
+		if eventSignup.AttendanceMode == nil || !isAttendanceMode(*eventSignup.AttendanceMode) {
+			return http.StatusBadRequest, errors.New("attendance mode must be either in_person or online for hybrid events")
+		}
+	} else if eventSignup.AttendanceMode != nil {
+		return http.StatusBadRequest, errors.New("attendance mode can only be chosen for hybrid events")
+	}
+	answers, err := event.ValidateAnswers(eventSignup.Answers)
+	if err != nil {
+		return http.StatusBadRequest, err
+	} else if err := eventSignup.SetAnswers(answers); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	// guests take places of the event together with the user, a signup is waitlisted as a whole if they do not all fit
+	if guests, err := event.ValidateGuests(eventSignup.Guests); err != nil {
+		return http.StatusBadRequest, err
+	} else if err := eventSignup.SetGuests(guests); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	// signups pending approval or the lottery draw do not take places until they are approved or drawn
+	status := model.SignupCreated
+	if event.NeedsApproval() || event.LotteryOpen() {
+		status = model.SignupPending
+	} else if available, err := event.HasPlaceFor(tx, eventSignup.Mode(), eventSignup.Places()); err != nil {
+		return http.StatusInternalServerError, err
+	} else if !available {
+		status = model.SignupWaitlisted
+	}
+	eventSignup.EventID = &event.ID
+	eventSignup.Event = event
+	eventSignup.UserID = &user.ID
+	eventSignup.User = user
+	eventSignup.Status = &status
+	if err := tx.Omit(clause.Associations).Save(eventSignup).Error; err != nil {
+		return http.StatusInternalServerError, err
+	} else if invite != nil {
+		if err := invite.Use(tx); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	return http.StatusCreated, nil
+}
+
+// withdrawSignup marks a signup record as withdrawn and promotes the waitlist if a place of the event is released
+// an error wrapping model.ErrSignupTransition is returned if the signup cannot be withdrawn
+func withdrawSignup(tx *gorm.DB, eventSignup *model.EventSignup) error {
+	released := *eventSignup.Status == model.SignupCreated
+	// a pending offer of the signup to another user lapses with the withdrawal
+	if err := eventSignup.Transition(tx, model.SignupWithdraw, map[string]interface{}{"transfer_to_id": nil, "transfer_offered_at": nil}); err != nil {
+		return err
+	} else if !released {
+		return nil
+	}
+	event := &model.Event{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(event, *eventSignup.EventID).Error; err != nil {
+		return err
+	}
+	return event.PromoteWaitlist(tx)
+}
+
 /*
  * Handlers for returning multiple events (sorting, pagination)
  */
 
-func EventsGet(ctx *gin.Context) {
-	// keys allowed for filter requests
-	filterKeys := map[string]struct{}{
-		"organizer_id": {},
-		"type":         {},
-		"time_begin":   {},
-		"time_end":     {},
+// fields of events allowed in filter and sort parameters
+var eventListQuery = &misc.ListQuery{
+	Table: "events",
+	Fields: map[string]misc.ListField{
+		"id":           {Column: "id", Type: misc.FieldInt, Filterable: true, Sortable: true},
+		"title":        {Column: "title", Type: misc.FieldString, Filterable: true, Sortable: true},
+		"organizer_id": {Column: "organizer_id", Type: misc.FieldInt, Filterable: true, Sortable: true},
+		"series_id":    {Column: "series_id", Type: misc.FieldInt, Filterable: true},
+		"type":         {Column: "type", Type: misc.FieldString, Filterable: true, Sortable: true},
+		"status":       {Column: "status", Type: misc.FieldString, Filterable: true},
+		"tag": {
+			Column:     "tags.name",
+			Type:       misc.FieldString,
+			Filterable: true,
+			Subquery:   "events.id IN (SELECT event_tags.event_id FROM event_tags JOIN tags ON tags.id = event_tags.tag_id WHERE %s)",
+		},
+		"time_begin": {Column: "time_begin", Type: misc.FieldTime, Filterable: true, Sortable: true},
+		"time_end":   {Column: "time_end", Type: misc.FieldTime, Filterable: true, Sortable: true},
+		"created_at": {Column: "created_at", Type: misc.FieldTime, Sortable: true},
+	},
+}
+
+// fields matched by search terms and their weights in relevance ranking
+var eventSearchFields = []struct {
+	condition string
+	weight    int
+}{
+	{"events.title LIKE ?", 4},
+	// values extracted from JSON are compared case-sensitively unless lowered
+	{"LOWER(JSON_UNQUOTE(JSON_EXTRACT(events.location_json, '$.building'))) LIKE ?", 2},
+	{"LOWER(JSON_UNQUOTE(JSON_EXTRACT(events.location_json, '$.address'))) LIKE ?", 2},
+	{"LOWER(JSON_UNQUOTE(JSON_EXTRACT(events.location_json, '$.platform'))) LIKE ?", 2},
+	{"events.organizer_id IN (SELECT id FROM users WHERE nickname LIKE ? AND deleted_at IS NULL)", 1},
+}
+
+// searchEvents keeps events matching every term of the search query in any of eventSearchFields
+// it returns the query and an expression of relevance which is used for ordering by the caller
+func searchEvents(tx *gorm.DB, query string) (*gorm.DB, clause.Expr) {
+	var relevanceSQL []string
+	var relevanceVars []interface{}
+	for _, term := range misc.SearchTerms(query) {
+		pattern := misc.LikePattern(term)
+		var conditions []string
+		var vars []interface{}
+		for _, field := range eventSearchFields {
+			conditions = append(conditions, field.condition)
+			vars = append(vars, pattern)
+			relevanceSQL = append(relevanceSQL, fmt.Sprintf("(CASE WHEN %s THEN %d ELSE 0 END)", field.condition, field.weight))
+			relevanceVars = append(relevanceVars, pattern)
+		}
+		tx = tx.Where("("+strings.Join(conditions, " OR ")+")", vars...)
+	}
+	if relevanceSQL == nil {
+		return tx, clause.Expr{}
+	}
+	return tx, clause.Expr{SQL: strings.Join(relevanceSQL, " + "), Vars: relevanceVars}
+}
+
+// maximum radius in meters of searching events nearby
+const maxNearRadius = 50000
+
+// nearEvents keeps physical events within radius meters of the point given in near ("latitude,longitude")
+// it returns the point searched and an expression of distance which is used for ordering by the caller
+func nearEvents(tx *gorm.DB, near string, radius string) (*gorm.DB, []float64, clause.Expr, []*misc.ErrorObject) {
+	var errorObjects []*misc.ErrorObject
+	var point []float64
+	if coordinates := strings.Split(near, ","); len(coordinates) == 2 {
+		latitude, latErr := strconv.ParseFloat(strings.TrimSpace(coordinates[0]), 64)
+		longitude, lngErr := strconv.ParseFloat(strings.TrimSpace(coordinates[1]), 64)
+		if latErr == nil && lngErr == nil && misc.ValidCoordinates(latitude, longitude) {
+			point = []float64{latitude, longitude}
+		}
 	}
+	if point == nil {
+		errorObjects = append(errorObjects, misc.ParameterError("near", "near must be coordinates in the format latitude,longitude"))
+	}
+	meters, err := strconv.ParseFloat(radius, 64)
+	if err != nil || meters <= 0 || meters > maxNearRadius {
+		errorObjects = append(errorObjects, misc.ParameterError("radius", fmt.Sprintf("radius must be a number of meters between 0 and %d", maxNearRadius)))
+	}
+	if errorObjects != nil {
+		return tx, nil, clause.Expr{}, errorObjects
+	}
+	distance := clause.Expr{
+		SQL:  "ST_Distance_Sphere(POINT(events.longitude, events.latitude), POINT(?, ?))",
+		Vars: []interface{}{point[1], point[0]},
+	}
+	// the range of latitude narrows events down with the index before distances are calculated
+	delta := meters / misc.MetersPerDegree
+	tx = tx.Where("events.latitude BETWEEN ? AND ?", point[0]-delta, point[0]+delta).
+		Where(distance.SQL+" <= ?", point[1], point[0], meters)
+	return tx, point, distance, nil
+}
+
+func EventsGet(ctx *gin.Context) {
 	// as per JSON:API specification v1.0, -id means sorting by id in descending order
 	sortQuery := ctx.DefaultQuery("sort", "-id")
 	// very important: page starts from 0
 	page, _ := strconv.Atoi(ctx.DefaultQuery("page", "0"))
 	filterArray := ctx.QueryArray("filter")
+	// full-text search, results are ranked by relevance before the order given in sort
+	searchQuery := ctx.Query("q")
+	// events nearby in the format near=latitude,longitude&radius=meters, results are sorted by distance first
+	nearQuery := ctx.Query("near")
+	radiusQuery := ctx.DefaultQuery("radius", "1000")
 
 	// set size of each page fixed at 10
 	size := 12
 	// calculate offset based on size and page
 	offset := page * size
 
-	// convert JSON:API sort query to SQL sorting syntax
-	sortSlice := strings.Split(sortQuery, ",")
-	for k, v := range sortSlice {
-		if string(v[0]) == "-" {
-			sortSlice[k] = v[1:] + " desc"
-		} else {
-			sortSlice[k] = v + " asc"
-		}
-	}
-	sort := strings.Join(sortSlice, ",")
-
 	var events []*model.Event
 	var count int64
 
 	db := ctx.MustGet("DB").(*gorm.DB)
-	tx := db
 	// build query transaction
-	for _, filter := range filterArray {
-		filterSlice := strings.Split(filter, ",")
-		if _, ok := filterKeys[filterSlice[0]]; !ok {
-			misc.ReturnStandardError(ctx, http.StatusBadRequest, fmt.Sprintf("invalid filter key: '%s'", filterSlice[0]))
-			return
-		} else if len(filterSlice) == 2 {
-			tx = tx.Where(fmt.Sprintf("%s = ?", filterSlice[0]), filterSlice[1])
-		} else if len(filterSlice) == 3 {
-			tx = tx.Where(fmt.Sprintf("%s %s ?", filterSlice[0], filterSlice[1]), filterSlice[2])
-		} else {
-			misc.ReturnStandardError(ctx, http.StatusBadRequest, fmt.Sprintf("invalid filter format: '%s'", filter))
-			return
+	tx, errorObjects := eventListQuery.Filter(db, filterArray)
+	tx = model.VisibleEvents(tx, optionalUser(ctx))
+	var point []float64
+	var distance clause.Expr
+	if nearQuery != "" {
+		var nearErrors []*misc.ErrorObject
+		tx, point, distance, nearErrors = nearEvents(tx, nearQuery, radiusQuery)
+		errorObjects = append(errorObjects, nearErrors...)
+	}
+	tx, relevance := searchEvents(tx, searchQuery)
+	// events are counted without ordering as distance and relevance are only selected when querying events
+	dbCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	countTx := tx.WithContext(dbCtx)
+	selects := []string{"events.*"}
+	var selectVars []interface{}
+	var orders []string
+	if distance.SQL != "" {
+		selects = append(selects, "("+distance.SQL+") AS distance")
+		selectVars = append(selectVars, distance.Vars...)
+		orders = append(orders, "distance")
+	}
+	if relevance.SQL != "" {
+		selects = append(selects, "("+relevance.SQL+") AS relevance")
+		selectVars = append(selectVars, relevance.Vars...)
+		orders = append(orders, "relevance DESC")
+	}
+	if len(selects) > 1 {
+		tx = tx.Select(strings.Join(selects, ", "), selectVars...)
+		for _, order := range orders {
+			tx = tx.Order(order)
 		}
 	}
-	dbCtx, _ := context.WithTimeout(context.Background(), time.Second)
-	tx.WithContext(dbCtx).Model(events).Count(&count)
-	totalPages := int(count) / size
-	if int(count)%size != 0 {
-		totalPages++
+	tx, sortErrors := eventListQuery.Sort(tx, sortQuery)
+	if errorObjects = append(errorObjects, sortErrors...); len(errorObjects) != 0 {
+		misc.ReturnErrors(ctx, http.StatusBadRequest, errorObjects)
+		return
 	}
+	countTx.Model(events).Count(&count)
+	totalPages := misc.TotalPages(count, size)
 	if totalPages != 0 && (page > totalPages-1 || page < 0) {
 		// trying to access a page that does not exist
 		misc.ReturnStandardError(ctx, http.StatusBadRequest, "page requested does not exist")
 		return
 	}
-	if err := tx.Preload(clause.Associations).Offset(offset).Order(sort).Limit(size).Find(&events).Error; err == nil {
+	if err := tx.Preload(clause.Associations).Preload("Series.Images").Offset(offset).Limit(size).Find(&events).Error; err == nil {
 		for _, event := range events {
 			event.LoadSignups(db)
+			event.HideReviewsFrom(optionalUser(ctx))
+			if err := event.HideLocationFrom(db, optionalUser(ctx)); err != nil {
+				misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+				return
+			}
+			if point != nil && event.Latitude != nil && event.Longitude != nil {
+				eventDistance := misc.Distance(point[0], point[1], *event.Latitude, *event.Longitude)
+				event.Distance = &eventDistance
+			}
 		}
 		var jsonString strings.Builder
 		var jsonData map[string]interface{}
-		var next, prev *string
 
 		ctx.Status(http.StatusOK)
 		if err := jsonapi.MarshalPayload(&jsonString, events); err == nil {
 			json.Unmarshal([]byte(jsonString.String()), &jsonData)
-			url := misc.APIAbsolutePath("/events") + "?sort=" + sortQuery + "&page="
-			firstString := url + "0"
-			var lastString string
-			if totalPages == 0 {
-				lastString = url + "0"
-			} else {
-				lastString = url + strconv.Itoa(totalPages-1)
-			}
-			if page == totalPages-1 || totalPages == 0 {
-				// already at last page
-				next = nil
-			} else {
-				nextString := url + strconv.Itoa(page+1)
-				next = &nextString
-			}
-			if page == 0 {
-				// already at first page
-				prev = nil
-			} else {
-				prevString := url + strconv.Itoa(page-1)
-				prev = &prevString
-			}
-			jsonData["links"] = map[string]*string{
-				jsonapi.KeyFirstPage:    &firstString,
-				jsonapi.KeyLastPage:     &lastString,
-				jsonapi.KeyNextPage:     next,
-				jsonapi.KeyPreviousPage: prev,
-			}
+			// links keep all query parameters other than page
+			linkQuery := ctx.Request.URL.Query()
+			linkQuery.Set("sort", sortQuery)
+			jsonData["links"] = misc.PageLinks("/events", linkQuery, page, totalPages)
 			jsonData["meta"] = map[string]int{
 				"total_pages":    totalPages,
 				"current_page":   page,
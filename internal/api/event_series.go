@@ -0,0 +1,495 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/jsonapi"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"schrodinger-box/internal/misc"
+	"schrodinger-box/internal/model"
+)
+
+/*
+ * Handlers for /event_series actions : recurring events and their occurrences
+ * single occurrences are edited or deleted through /event, while /event_series applies to all (future) occurrences
+ */
+
+func EventSeriesCreate(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to create event series")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	series := &model.EventSeries{}
+	if err := jsonapi.UnmarshalPayload(ctx.Request.Body, series); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "cannot unmarshal JSON of request: "+err.Error())
+		return
+	} else if series.Title == nil ||
+		series.TimeBegin == nil ||
+		series.TimeEnd == nil ||
+		series.Type == nil ||
+		series.Recurrence == nil ||
+		reflect.ValueOf(series.Location).IsNil() {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "not all fields required are provided")
+		return
+	} else if detail := validateLocation(series.Location); detail != "" {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, detail)
+		return
+	} else if series.TimeEnd.Before(*series.TimeBegin) {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "event cannot end before it begins")
+		return
+	}
+	geocodeLocation(series.Location)
+	recurrence, err := misc.ParseRecurrence(*series.Recurrence)
+	if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "invalid recurrence: "+err.Error())
+		return
+	}
+	occurrences, err := recurrence.Occurrences(*series.TimeBegin)
+	if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "invalid recurrence: "+err.Error())
+		return
+	}
+	series.OrganizerID = &user.ID
+	images := series.Images
+	db := ctx.MustGet("DB").(*gorm.DB)
+	tx := db.Begin()
+	if err := tx.Omit(clause.Associations).Save(series).Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// images are linked to the series and shared by all occurrences
+	if !linkImages(ctx, tx, series.ID, "event_series", images) {
+		tx.Rollback()
+		return
+	}
+	for _, timeBegin := range occurrences {
+		event := series.NewOccurrence(timeBegin)
+		if err := tx.Omit(clause.Associations).Save(event).Error; err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		} else if err := event.ScheduleReminders(tx); err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if status, err := loadSeries(db, series, series.ID); err != nil {
+		misc.ReturnStandardError(ctx, status, err.Error())
+		return
+	}
+	ctx.Status(http.StatusCreated)
+	if err := jsonapi.MarshalPayload(ctx.Writer, series); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func EventSeriesGet(ctx *gin.Context) {
+	series := &model.EventSeries{}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	// drafts and invite-only occurrences are hidden as they are when requested individually
+	if status, err := loadSeries(db, series, ctx.Param("id")); err != nil {
+		misc.ReturnStandardError(ctx, status, err.Error())
+		return
+	} else if err := series.FilterVisibleOccurrences(db, optionalUser(ctx)); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if err := series.HideLocationFrom(db, optionalUser(ctx)); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.Status(http.StatusOK)
+	if err := jsonapi.MarshalPayload(ctx.Writer, series); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// this updates the series and all its occurrences beginning at or after the occurrence given by query "from"
+// future occurrences (i.e. not yet begun) are updated if "from" is not given
+// a change of time_begin / time_end of the series shifts the occurrences by the same amount of time
+func EventSeriesUpdate(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to update event series")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	seriesRequest := &model.EventSeries{}
+	if err := jsonapi.UnmarshalPayload(ctx.Request.Body, seriesRequest); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "cannot unmarshal JSON of request: "+err.Error())
+		return
+	} else if seriesRequest.ID <= 0 {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "invalid event_series ID")
+		return
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	series := &model.EventSeries{}
+	if status, err := loadSeries(db, series, seriesRequest.ID); err != nil {
+		misc.ReturnStandardError(ctx, status, err.Error())
+		return
+	} else if *series.OrganizerID != user.ID {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you can only update event series organized by your own")
+		return
+	} else if seriesRequest.Recurrence != nil && *seriesRequest.Recurrence != *series.Recurrence {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "recurrence cannot be changed, please cancel future occurrences and create a new series instead")
+		return
+	} else if seriesRequest.Location != nil {
+		if detail := validateLocation(seriesRequest.Location); detail != "" {
+			misc.ReturnStandardError(ctx, http.StatusBadRequest, detail)
+			return
+		}
+		geocodeLocation(seriesRequest.Location)
+	}
+	from, status, err := seriesPivot(ctx, db, series)
+	if err != nil {
+		misc.ReturnStandardError(ctx, status, err.Error())
+		return
+	}
+	var beginShift, endShift time.Duration
+	if seriesRequest.TimeBegin != nil {
+		beginShift = seriesRequest.TimeBegin.Sub(*series.TimeBegin)
+		series.TimeBegin = seriesRequest.TimeBegin
+	}
+	if seriesRequest.TimeEnd != nil {
+		endShift = seriesRequest.TimeEnd.Sub(*series.TimeEnd)
+		series.TimeEnd = seriesRequest.TimeEnd
+	}
+	if series.TimeEnd.Before(*series.TimeBegin) {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "event cannot end before it begins")
+		return
+	}
+	if seriesRequest.Title != nil {
+		series.Title = seriesRequest.Title
+	}
+	if seriesRequest.Type != nil {
+		series.Type = seriesRequest.Type
+	}
+	if seriesRequest.Location != nil {
+		series.Location = seriesRequest.Location
+	}
+	if seriesRequest.Capacity != nil {
+		series.Capacity = seriesRequest.Capacity
+	}
+	tx := db.Begin()
+	if seriesRequest.Images != nil {
+		if _, ok := replaceImages(ctx, tx, series.ID, "event_series", series.Images, seriesRequest.Images); !ok {
+			tx.Rollback()
+			return
+		}
+	}
+	if err := tx.Omit(clause.Associations).Save(series).Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if err := series.LoadOccurrences(tx, from); err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, event := range series.Events {
+		if *event.Status == model.EventCancelled {
+			continue
+		}
+		eventRequest := &model.Event{
+			Title:    seriesRequest.Title,
+			Type:     seriesRequest.Type,
+			Location: seriesRequest.Location,
+			Capacity: seriesRequest.Capacity,
+		}
+		if beginShift != 0 {
+			timeBegin := event.TimeBegin.Add(beginShift)
+			eventRequest.TimeBegin = &timeBegin
+			// deadlines of the occurrence move together with its begin time
+			eventRequest.SignupOpenAt = shiftTime(event.SignupOpenAt, beginShift)
+			eventRequest.SignupCloseAt = shiftTime(event.SignupCloseAt, beginShift)
+			eventRequest.WithdrawBy = shiftTime(event.WithdrawBy, beginShift)
+		}
+		if endShift != 0 {
+			timeEnd := event.TimeEnd.Add(endShift)
+			eventRequest.TimeEnd = &timeEnd
+		}
+		changes := applyEventChanges(event, eventRequest)
+		if event.TimeEnd.Before(*event.TimeBegin) {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusBadRequest,
+				fmt.Sprintf("occurrence (id=%d) cannot end before it begins", event.ID))
+			return
+		} else if detail := validateDeadlines(event); detail != "" {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusBadRequest, fmt.Sprintf("occurrence (id=%d): %s", event.ID, detail))
+			return
+		} else if err := commitEventChanges(tx, event, changes); err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if status, err := loadSeries(db, series, series.ID); err != nil {
+		misc.ReturnStandardError(ctx, status, err.Error())
+		return
+	}
+	ctx.Status(http.StatusOK)
+	if err := jsonapi.MarshalPayload(ctx.Writer, series); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// this cancels all occurrences beginning at or after the occurrence given by query "from"
+// future occurrences (i.e. not yet begun) are cancelled if "from" is not given
+// occurrences without signups are deleted, the others are kept as cancelled events
+// the series itself is deleted as well if no occurrence is left
+func EventSeriesDelete(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to delete event series")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	series := &model.EventSeries{}
+	if status, err := loadSeries(db, series, ctx.Param("id")); err != nil {
+		misc.ReturnStandardError(ctx, status, err.Error())
+		return
+	} else if *series.OrganizerID != user.ID {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you can only delete event series organized by your own")
+		return
+	}
+	from, status, err := seriesPivot(ctx, db, series)
+	if err != nil {
+		misc.ReturnStandardError(ctx, status, err.Error())
+		return
+	}
+	var events []*model.Event
+	var remaining int64
+	tx := db.Begin()
+	if err := tx.Preload("Images").Preload("EventSignups").Where("series_id = ? AND time_begin >= ?", series.ID, from).Find(&events).Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, event := range events {
+		// occurrences with signups are cancelled to keep them in users' history, the others are deleted
+		var err error
+		if len(event.EventSignups) == 0 {
+			err = deleteEvent(tx, event)
+		} else if *event.Status != model.EventCancelled {
+			err = event.Cancel(tx, nil)
+		}
+		if err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if err := tx.Model(&model.Event{}).Where("series_id = ?", series.ID).Count(&remaining).Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if remaining == 0 {
+		if err := releaseImages(tx, series.Images); err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		} else if err := tx.Delete(series).Error; err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else {
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+/*
+ * Handlers for /event_series/:id/signup actions : signup & withdrawal of all future occurrences at once
+ */
+
+func EventSeriesSignupCreate(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to create signup record")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	// hybrid occurrences are joined in the attendance mode given, they are skipped if it is not given
+	mode := ctx.Query("attendance_mode")
+	if mode != "" && !isAttendanceMode(mode) {
+		misc.ReturnErrors(ctx, http.StatusBadRequest, []*misc.ErrorObject{misc.ParameterError("attendance_mode", "attendance mode must be either in_person or online")})
+		return
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	series := &model.EventSeries{}
+	if status, err := loadSeries(db, series, ctx.Param("id")); err != nil {
+		misc.ReturnStandardError(ctx, status, err.Error())
+		return
+	}
+	var events []*model.Event
+	var signups []*model.EventSignup
+	// occurrences are locked so that concurrent signups cannot exceed their capacity
+	tx := db.Begin()
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("series_id = ? AND time_begin > ?", series.ID, time.Now()).
+		Order("time_begin asc").
+		Find(&events).Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, event := range events {
+		// occurrences which are not open to everyone have to be joined individually
+		if !event.IsActive() || !event.IsPublished() || !event.IsOpen() || (event.IsHybrid() && mode == "") {
+			continue
+		} else if event.CheckSignupOpen(time.Now()) != nil {
+			// occurrences whose signup has not opened or has closed are skipped as well
+			continue
+		}
+		if active, err := event.ActiveSignup(tx, user.ID); err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		} else if active != nil {
+			// occurrences signed up individually before are skipped
+			continue
+		}
+		signup := &model.EventSignup{}
+		if event.IsHybrid() {
+			signup.AttendanceMode = &mode
+		}
+		if status, err := createSignup(tx, event, user, signup); err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, status, err.Error())
+			return
+		}
+		signups = append(signups, signup)
+	}
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// occurrences the user is waitlisted for are shown without their links
+	for _, signup := range signups {
+		if err := signup.Event.HideLocationFrom(db, user); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	ctx.Status(http.StatusCreated)
+	if err := jsonapi.MarshalPayload(ctx.Writer, signups); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func EventSeriesSignupDelete(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to delete signup record")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	series := &model.EventSeries{}
+	if status, err := loadSeries(db, series, ctx.Param("id")); err != nil {
+		misc.ReturnStandardError(ctx, status, err.Error())
+		return
+	}
+	var signups []*model.EventSignup
+	tx := db.Begin()
+	occurrences := tx.Model(&model.Event{}).Select("id").Where("series_id = ? AND time_begin > ?", series.ID, time.Now())
+	if err := tx.Preload("Event").
+		Where("user_id = ? AND event_id IN (?) AND status NOT IN ?", user.ID, occurrences, model.UnlistedStatuses).
+		Find(&signups).Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, signup := range signups {
+		// signups which cannot be withdrawn (e.g. attended) and confirmed ones past the withdrawal deadline are kept
+		if !model.CanTransition(*signup.Status, model.SignupWithdraw) ||
+			(*signup.Status == model.SignupCreated && signup.Event.CheckWithdrawOpen(time.Now()) != nil) {
+			continue
+		}
+		if err := withdrawSignup(tx, signup); errors.Is(err, model.ErrSignupTransition) {
+			// the signup has been changed by another request in the meantime
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusConflict, "signups have been changed by another request, please try again")
+			return
+		} else if err != nil {
+			tx.Rollback()
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else {
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+// shiftTime returns the time given moved by the duration, nil is returned if the time is not set
+func shiftTime(t *time.Time, shift time.Duration) *time.Time {
+	if t == nil {
+		return nil
+	}
+	shifted := t.Add(shift)
+	return &shifted
+}
+
+// loadSeries loads an event series with its images, organizer and all occurrences
+// HTTP status code is returned together with the error if the series cannot be loaded
+func loadSeries(db *gorm.DB, series *model.EventSeries, id interface{}) (int, error) {
+	if err := db.Preload("Images").Preload("Organizer").First(series, id).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return http.StatusNotFound, errors.New("event series does not exist")
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	} else if err := series.LoadOccurrences(db, time.Time{}); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// seriesPivot returns the begin time of the occurrence given by query "from", or current time if it is not given
+func seriesPivot(ctx *gin.Context, db *gorm.DB, series *model.EventSeries) (time.Time, int, error) {
+	fromID := ctx.Query("from")
+	if fromID == "" {
+		return time.Now(), http.StatusOK, nil
+	}
+	event := &model.Event{}
+	if err := db.Where("id = ? AND series_id = ?", fromID, series.ID).First(event).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, http.StatusNotFound, errors.New("occurrence specified does not belong to this series")
+	} else if err != nil {
+		return time.Time{}, http.StatusInternalServerError, err
+	}
+	return *event.TimeBegin, http.StatusOK, nil
+}
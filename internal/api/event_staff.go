@@ -0,0 +1,177 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/jsonapi"
+	"gorm.io/gorm"
+
+	"schrodinger-box/internal/misc"
+	"schrodinger-box/internal/model"
+)
+
+/*
+ * Handlers for /event/:id/staff actions : invitation, acceptance & removal of event staff
+ */
+
+func EventStaffCreate(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to invite event staff")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	staff := &model.EventStaff{}
+	if err := jsonapi.UnmarshalPayload(ctx.Request.Body, staff); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "cannot unmarshal JSON of request: "+err.Error())
+		return
+	} else if staff.Role == nil || staff.User == nil || staff.User.ID <= 0 {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "not all fields required are provided")
+		return
+	} else if *staff.Role != model.StaffCoOrganizer && *staff.Role != model.StaffChecker {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "staff can only be invited as co-organizer or checker")
+		return
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	event := &model.Event{}
+	invitee := &model.User{}
+	var invited int64
+	if err := db.First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !requireStaffRole(ctx, db, event, user, model.ManagerRoles, "only organizers can invite event staff") {
+		return
+	} else if err := db.Preload("Subscription").First(invitee, staff.User.ID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "user invited does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if err := db.Model(&model.EventStaff{}).Where("event_id = ? AND user_id = ?", event.ID, invitee.ID).Count(&invited).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if invited != 0 || invitee.ID == *event.OrganizerID {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "this user has already been invited to the event staff")
+		return
+	}
+	status := "invited"
+	staff.ID = 0
+	staff.EventID = &event.ID
+	staff.UserID = &invitee.ID
+	staff.User = invitee
+	staff.Status = &status
+	tx := db.Begin()
+	if err := tx.Omit("Event", "User").Create(staff).Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	text := fmt.Sprintf("%s invited you to join the staff of \"%s\" (%s) as %s.",
+		*user.Nickname, *event.Title, event.TimeBegin.Format(model.NotificationTimeFormat), *staff.Role)
+	if err := invitee.CreateNotificationAll(tx, "EventUpdate", text, time.Now()); err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.Status(http.StatusCreated)
+	if err := jsonapi.MarshalPayload(ctx.Writer, staff); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// this is only done by the user invited
+func EventStaffAccept(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to accept invitation")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	staff := &model.EventStaff{}
+	if err := db.Where("event_id = ?", ctx.Param("id")).First(staff, ctx.Param("staff_id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "staff invitation does not exist")
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else if *staff.UserID != user.ID {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you can only accept invitation sent to yourself")
+	} else if *staff.Status != "invited" {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "invitation has already been accepted")
+	} else if err := db.Model(staff).Update("status", "active").Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else {
+		ctx.Status(http.StatusOK)
+		if err := jsonapi.MarshalPayload(ctx.Writer, staff); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		}
+	}
+}
+
+// staff can leave by themselves, otherwise the owner removes anyone and co-organizers remove checkers only
+func EventStaffDelete(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to remove event staff")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	event := &model.Event{}
+	staff := &model.EventStaff{}
+	if err := db.First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if err := db.Where("event_id = ?", event.ID).First(staff, ctx.Param("staff_id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event staff does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if *staff.UserID != user.ID {
+		role, err := event.StaffRole(db, user.ID)
+		if err != nil {
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		} else if role != model.StaffOwner && (role != model.StaffCoOrganizer || *staff.Role != model.StaffChecker) {
+			misc.ReturnStandardError(ctx, http.StatusForbidden, "you are not allowed to remove this member of event staff")
+			return
+		}
+	}
+	if err := db.Delete(staff).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else {
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+// requireStaffRole checks whether the user takes one of the roles given in the event
+// error response is written and false is returned if the user does not
+func requireStaffRole(ctx *gin.Context, db *gorm.DB, event *model.Event, user *model.User, roles []string, detail string) bool {
+	if allowed, err := event.HasStaffRole(db, user.ID, roles); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return false
+	} else if !allowed {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, detail)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/jsonapi"
+	"gorm.io/gorm"
+
+	"schrodinger-box/internal/misc"
+	"schrodinger-box/internal/model"
+)
+
+/*
+ * Handlers for /event/:id/invites actions : invite codes of invite-only events issued by organizers
+ */
+
+func EventInviteCreate(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to create invites")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	invite := &model.EventInvite{}
+	// all fields of an invite are optional
+	if ctx.Request.ContentLength != 0 {
+		if err := jsonapi.UnmarshalPayload(ctx.Request.Body, invite); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusBadRequest, "cannot unmarshal JSON of request: "+err.Error())
+			return
+		}
+	}
+	if invite.ExpiresAt != nil && !invite.ExpiresAt.After(time.Now()) {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "invite cannot expire in the past")
+		return
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	event := &model.Event{}
+	if err := db.First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !requireStaffRole(ctx, db, event, user, model.ManagerRoles, "only organizers can create invites") {
+		return
+	} else if event.IsOpen() {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "invites can only be created for invite-only events")
+		return
+	}
+	code, err := model.NewInviteCode()
+	if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	invite.ID = 0
+	invite.EventID = &event.ID
+	invite.Code = code
+	invite.UsedCount = 0
+	invite.CreatedByID = &user.ID
+	if err := db.Omit("Event").Create(invite).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	invite.Link = inviteLink(invite)
+	ctx.Status(http.StatusCreated)
+	if err := jsonapi.MarshalPayload(ctx.Writer, invite); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func EventInvitesGet(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to view invites")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	event := &model.Event{}
+	var invites []*model.EventInvite
+	if err := db.First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !requireStaffRole(ctx, db, event, user, model.ManagerRoles, "only organizers can view invites") {
+		return
+	} else if err := db.Where("event_id = ?", event.ID).Order("id").Find(&invites).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, invite := range invites {
+		invite.Link = inviteLink(invite)
+	}
+	ctx.Status(http.StatusOK)
+	if err := jsonapi.MarshalPayload(ctx.Writer, invites); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// revoked invites cannot be used any more, users who have joined with them stay signed up
+func EventInviteDelete(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to revoke invites")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	event := &model.Event{}
+	invite := &model.EventInvite{}
+	if err := db.First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else if !requireStaffRole(ctx, db, event, user, model.ManagerRoles, "only organizers can revoke invites") {
+		return
+	} else if err := db.Where("event_id = ?", event.ID).First(invite, ctx.Param("invite_id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "invite does not exist")
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else if err := db.Delete(invite).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else {
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+// link to the event carrying the invite code, which is accepted by EventGet as the invite query parameter
+func inviteLink(invite *model.EventInvite) string {
+	return misc.APIAbsolutePath(fmt.Sprintf("/event/%d?invite=%s", *invite.EventID, url.QueryEscape(invite.Code)))
+}
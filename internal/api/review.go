@@ -0,0 +1,305 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/jsonapi"
+	"gorm.io/gorm"
+
+	"schrodinger-box/internal/misc"
+	"schrodinger-box/internal/model"
+)
+
+/*
+ * Handlers for /event/:id/reviews & /review_flags actions : public listing, replies & moderation of reviews
+ */
+
+// reviews of an event, latest reviews come first, names of anonymous reviewers are hidden
+// rating aggregates of the event are in the meta of the document
+func EventReviewsGet(ctx *gin.Context) {
+	// very important: page starts from 0
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "0"))
+	if err != nil {
+		misc.ReturnErrors(ctx, http.StatusBadRequest, []*misc.ErrorObject{misc.ParameterError("page", "page must be an integer")})
+		return
+	}
+	size := 10
+	db := ctx.MustGet("DB").(*gorm.DB)
+	event := &model.Event{}
+	var signups []*model.EventSignup
+	var count int64
+	if err := db.First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if visible, err := event.VisibleTo(db, optionalUser(ctx), ctx.Query("invite")); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !visible {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err := event.LoadSignups(db); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	reviewed := func() *gorm.DB {
+		return db.Model(&model.EventSignup{}).Where("event_id = ? AND status = ? AND review_hidden_at IS NULL", event.ID, "reviewed")
+	}
+	if err := reviewed().Count(&count).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	totalPages := misc.TotalPages(count, size)
+	if totalPages != 0 && (page > totalPages-1 || page < 0) {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "page requested does not exist")
+		return
+	}
+	if err := reviewed().Preload("User").Order("reviewed_at desc").Order("id desc").
+		Offset(page * size).Limit(size).Find(&signups).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	reviews := make([]*model.EventReview, 0, len(signups))
+	for _, signup := range signups {
+		reviews = append(reviews, signup.Review())
+	}
+	var jsonString strings.Builder
+	var jsonData map[string]interface{}
+	if err := jsonapi.MarshalPayload(&jsonString, reviews); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	json.Unmarshal([]byte(jsonString.String()), &jsonData)
+	jsonData["links"] = misc.PageLinks("/event/"+strconv.Itoa(int(event.ID))+"/reviews", ctx.Request.URL.Query(), page, totalPages)
+	jsonData["meta"] = map[string]interface{}{
+		"rating":         event.Rating,
+		"total_pages":    totalPages,
+		"current_page":   page,
+		"max_page_size":  size,
+		"this_page_size": len(reviews),
+	}
+	ctx.Status(http.StatusOK)
+	json.NewEncoder(ctx.Writer).Encode(jsonData)
+}
+
+// findReview loads a review (i.e. a reviewed signup record) of the event in the path
+// error response is written and false is returned if it cannot be found
+func findReview(ctx *gin.Context, db *gorm.DB, signup *model.EventSignup) bool {
+	if err := db.Preload("User").Where("event_id = ? AND status = ?", ctx.Param("id"), "reviewed").
+		First(signup, ctx.Param("review_id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "review does not exist")
+		return false
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
+}
+
+// organizers reply publicly to a review, each review can only be replied once
+func EventReviewReply(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to reply to reviews")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	reviewRequest := &model.EventReview{}
+	if err := jsonapi.UnmarshalPayload(ctx.Request.Body, reviewRequest); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "cannot unmarshal JSON of request: "+err.Error())
+		return
+	} else if reviewRequest.Reply == nil || strings.TrimSpace(*reviewRequest.Reply) == "" {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "reply must be provided")
+		return
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	event := &model.Event{}
+	signup := &model.EventSignup{}
+	if err := db.First(event, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if !requireStaffRole(ctx, db, event, user, model.ManagerRoles, "only organizers can reply to reviews") {
+		return
+	} else if !findReview(ctx, db, signup) {
+		return
+	} else if signup.ReviewReply != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "this review has already been replied")
+		return
+	}
+	now := time.Now()
+	if err := db.Model(signup).Updates(model.EventSignup{ReviewReply: reviewRequest.Reply, ReviewRepliedAt: &now}).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.Status(http.StatusOK)
+	if err := jsonapi.MarshalPayload(ctx.Writer, signup.Review()); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// any user can flag a review with a reason, admins are to decide whether it should be hidden
+func ReviewFlagCreate(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to flag reviews")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	flag := &model.ReviewFlag{}
+	if err := jsonapi.UnmarshalPayload(ctx.Request.Body, flag); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "cannot unmarshal JSON of request: "+err.Error())
+		return
+	} else if flag.Reason == nil || strings.TrimSpace(*flag.Reason) == "" {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "reason must be provided")
+		return
+	} else if len(*flag.Reason) > model.MaxFlagReasonLength {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, fmt.Sprintf("reason must not be longer than %d characters", model.MaxFlagReasonLength))
+		return
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	signup := &model.EventSignup{}
+	var flagged int64
+	if !findReview(ctx, db, signup) {
+		return
+	} else if signup.ReviewHiddenAt != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "this review has already been hidden")
+		return
+	} else if err := db.Model(&model.ReviewFlag{}).Where("signup_id = ? AND user_id = ?", signup.ID, user.ID).Count(&flagged).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if flagged != 0 {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "you have already flagged this review")
+		return
+	}
+	status := "open"
+	flag.ID = 0
+	flag.SignupID = &signup.ID
+	flag.UserID = &user.ID
+	flag.Status = &status
+	if err := db.Omit("Signup", "User").Create(flag).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	flag.Review = signup.Review()
+	ctx.Status(http.StatusCreated)
+	if err := jsonapi.MarshalPayload(ctx.Writer, flag); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// admins hide a flagged review, all open flags of the review are closed as hidden
+func EventReviewHide(ctx *gin.Context) {
+	if !requireAdmin(ctx, "only admins can hide reviews") {
+		return
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	signup := &model.EventSignup{}
+	var flagged int64
+	if !findReview(ctx, db, signup) {
+		return
+	} else if signup.ReviewHiddenAt != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "this review has already been hidden")
+		return
+	} else if err := db.Model(&model.ReviewFlag{}).Where("signup_id = ?", signup.ID).Count(&flagged).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if flagged == 0 {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "only reviews flagged by users can be hidden")
+		return
+	}
+	now := time.Now()
+	tx := db.Begin()
+	if err := tx.Model(signup).Update("review_hidden_at", now).Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if err := tx.Model(&model.ReviewFlag{}).Where("signup_id = ? AND status = ?", signup.ID, "open").Update("status", "hidden").Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// admins keep a review flagged, the flag is closed as dismissed
+func ReviewFlagDismiss(ctx *gin.Context) {
+	if !requireAdmin(ctx, "only admins can dismiss flags") {
+		return
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	flag := &model.ReviewFlag{}
+	if err := db.First(flag, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "flag does not exist")
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else if *flag.Status != "open" {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "this flag has already been handled")
+	} else if err := db.Model(flag).Update("status", "dismissed").Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else {
+		ctx.Status(http.StatusOK)
+		if err := jsonapi.MarshalPayload(ctx.Writer, flag); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		}
+	}
+}
+
+// flags for admins to handle, oldest flags come first
+// Query parameters:
+// - status : open (default), hidden or dismissed
+func ReviewFlagsGet(ctx *gin.Context) {
+	if !requireAdmin(ctx, "only admins can view flags") {
+		return
+	}
+	status := ctx.DefaultQuery("status", "open")
+	if status != "open" && status != "hidden" && status != "dismissed" {
+		misc.ReturnErrors(ctx, http.StatusBadRequest, []*misc.ErrorObject{misc.ParameterError("status", "status must be open, hidden or dismissed")})
+		return
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	var flags []*model.ReviewFlag
+	if err := db.Preload("Signup").Preload("Signup.User").Preload("User").Where("status = ?", status).Order("id").Find(&flags).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, flag := range flags {
+		if flag.Signup != nil {
+			flag.Review = flag.Signup.Review()
+		}
+	}
+	ctx.Status(http.StatusOK)
+	if err := jsonapi.MarshalPayload(ctx.Writer, flags); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// requireAdmin checks whether the request is made by an admin
+// error response is written and false is returned if it is not
+func requireAdmin(ctx *gin.Context, detail string) bool {
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to moderate content")
+		return false
+	} else if !userInterface.(*model.User).IsAdmin() {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, detail)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/jsonapi"
+	"gorm.io/gorm"
+
+	"schrodinger-box/internal/misc"
+	"schrodinger-box/internal/model"
+)
+
+// This file contains handlers of the tag vocabulary
+
+// list all tags with the number of events tagged with each, most used tags come first
+func TagsGet(ctx *gin.Context) {
+	var tags []*model.Tag
+	db := ctx.MustGet("DB").(*gorm.DB)
+	if err := db.Find(&tags).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if err := model.CountTagUsages(db, tags); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		if *tags[i].UsageCount != *tags[j].UsageCount {
+			return *tags[i].UsageCount > *tags[j].UsageCount
+		}
+		return *tags[i].Name < *tags[j].Name
+	})
+	ctx.Status(http.StatusOK)
+	if err := jsonapi.MarshalPayload(ctx.Writer, tags); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// resolveTags replaces tags given in a relationship (by ID only) with the complete records in the vocabulary
+// HTTP status code is returned together with the error if any of the tags does not exist
+func resolveTags(db *gorm.DB, tags []*model.Tag) ([]*model.Tag, int, error) {
+	resolved := make([]*model.Tag, 0, len(tags))
+	var unknown []string
+	for _, tag := range tags {
+		record := &model.Tag{}
+		if tag.ID <= 0 {
+			return nil, http.StatusBadRequest, errors.New("invalid tag ID")
+		} else if err := db.First(record, tag.ID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			unknown = append(unknown, fmt.Sprint(tag.ID))
+		} else if err != nil {
+			return nil, http.StatusInternalServerError, err
+		} else {
+			resolved = append(resolved, record)
+		}
+	}
+	if unknown != nil {
+		return nil, http.StatusNotFound, errors.New("tags specified not found: " + strings.Join(unknown, ", "))
+	}
+	return resolved, http.StatusOK, nil
+}
+
+// relationshipGiven tells whether a relationship is given in the payload of a request
+// this is needed as jsonapi leaves a to-many relationship nil if its data is an empty array
+func relationshipGiven(payload []byte, relation string) bool {
+	var document struct {
+		Data struct {
+			Relationships map[string]struct {
+				Data json.RawMessage `json:"data"`
+			} `json:"relationships"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &document); err != nil {
+		return false
+	}
+	relationship, ok := document.Data.Relationships[relation]
+	return ok && len(relationship.Data) != 0 && string(relationship.Data) != "null"
+}
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/jsonapi"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"schrodinger-box/internal/misc"
+	"schrodinger-box/internal/model"
+)
+
+/*
+ * Handlers for /event_signup/:id/transfer actions : transfer of signups to other registered users
+ */
+
+// the holder of a signup offers it to another user given by transfer_to_id, who has to accept it
+// Status codes:
+// - 200 : the signup has been offered, the recipient is notified
+// - 400 : payload is invalid, the recipient cannot take the signup, or the event no longer allows withdrawals
+// - 403 : the signup is not held by the user
+// - 404 : signup or recipient does not exist
+// - 409 : the signup cannot be transferred in its status or has already been offered
+func EventSignupTransferCreate(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to transfer signups")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	signupRequest := &model.EventSignup{}
+	if err := jsonapi.UnmarshalPayload(ctx.Request.Body, signupRequest); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "cannot unmarshal JSON of request: "+err.Error())
+		return
+	} else if signupRequest.TransferToID == nil {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "transfer_to_id must be provided")
+		return
+	} else if *signupRequest.TransferToID == user.ID {
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, "you cannot transfer a signup to yourself")
+		return
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	signup := &model.EventSignup{}
+	recipient := &model.User{}
+	if err := db.Preload("Event").First(signup, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event signup record does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if *signup.UserID != user.ID {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you can only transfer your own signup record")
+		return
+	} else if err := db.Preload("Subscription").First(recipient, *signupRequest.TransferToID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "user to transfer to does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	event := signup.Event
+	if status, detail := checkTransferRecipient(db, event, recipient); status != 0 {
+		misc.ReturnStandardError(ctx, status, detail)
+		return
+	}
+	tx := db.Begin()
+	if err := signup.OfferTransfer(tx, recipient, time.Now()); errors.Is(err, model.ErrTransferNotAllowed) || errors.Is(err, model.ErrTransferPending) {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if err := event.HideLocationFrom(db, user); err != nil {
+		// waitlisted signups can be transferred, their holders cannot see the link yet
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.Status(http.StatusOK)
+	if err := jsonapi.MarshalPayload(ctx.Writer, signup); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// the recipient of an offer takes over the signup with its status, answers to registration questions are given in the payload
+// guests of the previous holder are not transferred
+// Status codes:
+// - 200 : the signup has been transferred, the previous holder is notified
+// - 400 : answers are invalid, the recipient cannot take the signup, or the event no longer allows withdrawals
+// - 404 : signup does not exist or has not been offered to the user
+// - 409 : the user already holds a signup of the event, or the signup can no longer be transferred
+func EventSignupTransferAccept(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to accept signups")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	signupRequest := &model.EventSignup{}
+	// answers are only needed if the event has registration questions so the payload can be omitted
+	if ctx.Request.ContentLength != 0 {
+		if err := jsonapi.UnmarshalPayload(ctx.Request.Body, signupRequest); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusBadRequest, "cannot unmarshal JSON of request: "+err.Error())
+			return
+		}
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	signup := &model.EventSignup{}
+	event := &model.Event{}
+	recipient := &model.User{}
+	if err := db.Preload("Subscription").First(recipient, user.ID).Error; err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// the event row is locked so that the recipient cannot sign up for the event concurrently
+	tx := db.Begin()
+	if err := tx.Preload("User").Preload("User.Subscription").First(signup, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event signup record does not exist")
+		return
+	} else if err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if signup.TransferToID == nil || *signup.TransferToID != user.ID {
+		// offers to other users are hidden as if they do not exist
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusNotFound, model.ErrTransferNotFound.Error())
+		return
+	} else if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(event, *signup.EventID).Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if status, detail := checkTransferRecipient(tx, event, recipient); status != 0 {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, status, detail)
+		return
+	}
+	// answers of the previous holder are not passed on, the recipient answers registration questions himself/herself
+	answers, err := event.ValidateAnswers(signupRequest.Answers)
+	if err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := event.AcceptTransfer(tx, signup, recipient, answers, time.Now()); errors.Is(err, model.ErrTransferNotFound) {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusNotFound, err.Error())
+		return
+	} else if errors.Is(err, model.ErrTransferNotAllowed) || errors.Is(err, model.ErrSignupExists) || errors.Is(err, model.ErrSignupRejected) {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusConflict, err.Error())
+		return
+	} else if err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	signup.Event = event
+	if err := event.HideLocationFrom(db, user); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx.Status(http.StatusOK)
+	if err := jsonapi.MarshalPayload(ctx.Writer, signup); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// the holder cancels the offer of a signup, or the recipient declines it, the other party is notified
+// Status codes:
+// - 204 : the offer has been cancelled or declined
+// - 404 : signup does not exist or there is no offer of it involving the user
+func EventSignupTransferDelete(ctx *gin.Context) {
+	var user *model.User
+	if userInterface, exists := ctx.Get("User"); !exists {
+		misc.ReturnStandardError(ctx, http.StatusForbidden, "you have to be a registered user to cancel or decline transfers")
+		return
+	} else {
+		user = userInterface.(*model.User)
+	}
+	db := ctx.MustGet("DB").(*gorm.DB)
+	signup := &model.EventSignup{}
+	if err := db.Preload("Event").Preload("User").Preload("User.Subscription").First(signup, ctx.Param("id")).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "event signup record does not exist")
+		return
+	} else if err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if signup.TransferToID == nil || (*signup.UserID != user.ID && *signup.TransferToID != user.ID) {
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "there is no pending transfer of this signup")
+		return
+	}
+	declined := *signup.TransferToID == user.ID
+	notified := signup.User
+	if !declined {
+		notified = &model.User{}
+		if err := db.Preload("Subscription").First(notified, *signup.TransferToID).Error; err != nil {
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	tx := db.Begin()
+	if err := signup.CancelTransfer(tx, notified, declined, time.Now()); errors.Is(err, model.ErrTransferNotFound) {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusNotFound, "there is no pending transfer of this signup")
+	} else if err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else if err := tx.Commit().Error; err != nil {
+		tx.Rollback()
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+	} else {
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+// checkTransferRecipient checks whether a signup of the event can be transferred to the recipient now
+// HTTP status code and error detail are returned if it cannot, otherwise the status code is 0
+func checkTransferRecipient(db *gorm.DB, event *model.Event, recipient *model.User) (int, string) {
+	// the holder gives up the signup by transferring it, so transfers are subject to the withdrawal deadline
+	if !event.IsActive() {
+		return http.StatusBadRequest, fmt.Sprintf("signups of events which have been %s cannot be transferred", *event.Status)
+	} else if !event.AllowsTransfer() {
+		return http.StatusBadRequest, "signups of invite-only events, events requiring approval or lottery events cannot be transferred"
+	} else if err := event.CheckWithdrawOpen(time.Now()); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if role, err := event.StaffRole(db, recipient.ID); err != nil {
+		return http.StatusInternalServerError, err.Error()
+	} else if role != "" {
+		return http.StatusBadRequest, "signups cannot be transferred to staff of the event"
+	}
+	if active, err := event.ActiveSignup(db, recipient.ID); err != nil {
+		return http.StatusInternalServerError, err.Error()
+	} else if active != nil {
+		return http.StatusConflict, "the user to transfer to already holds a signup of this event"
+	}
+	return 0, ""
+}
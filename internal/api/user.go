@@ -25,7 +25,23 @@ func UserGetSelf(ctx *gin.Context) {
 		return
 	}
 	user := userInterface.(*model.User)
-	user.LoadSignups(ctx.MustGet("DB").(*gorm.DB))
+	db := ctx.MustGet("DB").(*gorm.DB)
+	user.LoadSignups(db)
+	// users can see names of their own guests, but not their own reviews hidden by admins
+	for _, signup := range user.EventSignups {
+		signup.HideReviewFrom(user)
+		if err := signup.LoadGuests(); err != nil {
+			misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if err := user.LoadReputation(db); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if err := hideSignupLocations(db, user.EventSignups, user); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
 	ctx.Status(http.StatusOK)
 	if err := jsonapi.MarshalPayload(ctx.Writer, user); err != nil {
 		http.Error(ctx.Writer, err.Error(), http.StatusInternalServerError)
@@ -94,6 +110,20 @@ func UserGet(ctx *gin.Context) {
 		}
 	}
 	user.LoadSignups(db)
+	// reviews written by the user are only shown to himself/herself, others see them through /event/:id/reviews
+	for _, signup := range user.EventSignups {
+		signup.HideReviewFrom(optionalUser(ctx))
+	}
+	if err := user.LoadReputation(db); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if user.EventSignups, err = visibleSignups(db, user.EventSignups, optionalUser(ctx)); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	} else if err := hideSignupLocations(db, user.EventSignups, optionalUser(ctx)); err != nil {
+		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
+		return
+	}
 	ctx.Status(http.StatusOK)
 	if err := jsonapi.MarshalPayload(ctx.Writer, user); err != nil {
 		misc.ReturnStandardError(ctx, http.StatusInternalServerError, err.Error())
@@ -254,3 +284,30 @@ func UserSMSUnbind(ctx *gin.Context) {
 		ctx.Status(http.StatusNoContent)
 	}
 }
+
+// visibleSignups leaves out signups of events the viewer (nil if anonymous) cannot see, i.e. drafts and invite-only events
+func visibleSignups(db *gorm.DB, signups []*model.EventSignup, viewer *model.User) ([]*model.EventSignup, error) {
+	visible := make([]*model.EventSignup, 0, len(signups))
+	for _, signup := range signups {
+		if signup.Event == nil {
+			continue
+		} else if ok, err := signup.Event.VisibleTo(db, viewer, ""); err != nil {
+			return nil, err
+		} else if ok {
+			visible = append(visible, signup)
+		}
+	}
+	return visible, nil
+}
+
+// hideSignupLocations hides location details of events side-loaded with signups from the viewer (nil if anonymous)
+func hideSignupLocations(db *gorm.DB, signups []*model.EventSignup, viewer *model.User) error {
+	for _, signup := range signups {
+		if signup.Event == nil {
+			continue
+		} else if err := signup.Event.HideLocationFrom(db, viewer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package external
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"schrodinger-box/internal/model"
+)
+
+// this file contains geocoders resolving coordinates of physical locations
+
+var ErrLocationNotFound = errors.New("location cannot be geocoded")
+
+// Geocoder resolves latitude and longitude of a physical location
+// implementations return ErrLocationNotFound if the location is unknown to them
+type Geocoder interface {
+	Geocode(location *model.PhysicalLocation) (latitude float64, longitude float64, err error)
+}
+
+// geocoder used for new and updated physical locations, no coordinates are resolved if it is nil
+var ActiveGeocoder Geocoder
+
+// PostalCodeGeocoder is an offline geocoder looking up zip codes in a table loaded into memory
+type PostalCodeGeocoder struct {
+	coordinates map[string][2]float64
+}
+
+// load a postal code table from a CSV file with lines in the format: zip_code,latitude,longitude
+// lines starting with # are ignored
+func NewPostalCodeGeocoder(path string) (*PostalCodeGeocoder, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+	geocoder := &PostalCodeGeocoder{coordinates: make(map[string][2]float64)}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		latitude, latErr := strconv.ParseFloat(record[1], 64)
+		longitude, lngErr := strconv.ParseFloat(record[2], 64)
+		if latErr != nil || lngErr != nil {
+			return nil, fmt.Errorf("invalid coordinates of zip code %s", record[0])
+		}
+		geocoder.coordinates[strings.TrimSpace(record[0])] = [2]float64{latitude, longitude}
+	}
+	return geocoder, nil
+}
+
+// number of zip codes in the table
+func (geocoder *PostalCodeGeocoder) Size() int {
+	return len(geocoder.coordinates)
+}
+
+func (geocoder *PostalCodeGeocoder) Geocode(location *model.PhysicalLocation) (float64, float64, error) {
+	if coordinates, ok := geocoder.coordinates[strings.TrimSpace(location.ZipCode)]; ok {
+		return coordinates[0], coordinates[1], nil
+	}
+	return 0, 0, ErrLocationNotFound
+}
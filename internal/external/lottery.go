@@ -0,0 +1,23 @@
+package external
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"schrodinger-box/internal/model"
+)
+
+// this draws lotteries of events whose draw time has come, results are queued as notifications for mediums to send
+
+func LotteryCron(db *gorm.DB) {
+	drawn, err := model.DrawDueLotteries(db, time.Now())
+	if err != nil {
+		fmt.Fprintf(gin.DefaultWriter, "[Schrodinger's Box] Cannot draw lotteries - %s\n", err.Error())
+	}
+	if len(drawn) != 0 && gin.IsDebugging() {
+		fmt.Fprintf(gin.DefaultWriter, "[Schrodinger's Box] Lotteries drawn: %v\n", drawn)
+	}
+}
@@ -1,6 +1,7 @@
 package external
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -11,12 +12,6 @@ import (
 
 // this file contains general functions for notification system to work
 
-var timeOffset = map[string]time.Duration{
-	"1day":  24 * time.Hour,
-	"4hr":   4 * time.Hour,
-	"30min": 30 * time.Minute,
-}
-
 func NotificationCron(db *gorm.DB) {
 	// generate notifications from batches
 	var batches []*model.NotificationBatch
@@ -25,32 +20,43 @@ func NotificationCron(db *gorm.DB) {
 		link := strings.Split(*batch.LinkID, "-")
 		switch link[0] {
 		case "Event":
+			var sendTime time.Time
+			var action string
 			event := &model.Event{}
-			if err := db.Preload("EventSignups").
+			if err := db.Preload("EventSignups", "status = ?", "created").
 				Preload("EventSignups.User").
 				Preload("EventSignups.User.Subscription").
-				First(event, link[1]).Error; err != nil {
+				First(event, link[1]).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+				// the event has been deleted, there is no one to notify
+				batch.Cancelled(db)
+				continue
+			} else if err != nil {
 				fmt.Fprintf(gin.DefaultWriter, "[Schrodinger's Box] Cannot find resource - %s", err.Error())
 				continue
 			}
+			switch link[2] {
+			case "1day", "4hr", "30min":
+				action = "EventReminder"
+				sendTime = event.TimeBegin.Add(-model.ReminderOffsets[link[2]])
+			default:
+				continue
+				// TODO: do nothing for other actions
+			}
+			if time.Now().Before(sendTime) {
+				// reminders are generated when they are due so that late signups are included
+				continue
+			}
 			tx := db.Begin()
 			errorOccurred := false
 			for _, signup := range event.EventSignups {
-				var sendTime time.Time
-				var action string
-				switch link[2] {
-				case "1day", "4hr", "30min":
-					action = "EventReminder"
-					sendTime = event.TimeBegin.Add(-timeOffset[link[2]])
-				default:
-					continue
-					// TODO: do nothing for other actions
-				}
 				text := batch.GenText(map[string]string{
-					"fullname": signup.User.Fullname,
-					"nickname": *signup.User.Nickname,
-					"email":    signup.User.Email,
-					"nusid":    signup.User.NUSID,
+					"fullname":    signup.User.Fullname,
+					"nickname":    *signup.User.Nickname,
+					"email":       signup.User.Email,
+					"nusid":       signup.User.NUSID,
+					"event_title": *event.Title,
+					"time_begin":  event.TimeBegin.Format(model.NotificationTimeFormat),
+					"time_end":    event.TimeEnd.Format(model.NotificationTimeFormat),
 				})
 				// we have the text and now create notification objects for all enabled mediums
 				if err := signup.User.CreateNotificationAll(tx, action, text, sendTime, batch.ID); err != nil {
@@ -0,0 +1,23 @@
+package external
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"schrodinger-box/internal/model"
+)
+
+// this publishes drafts whose publishing time has come, suggestions are queued as notifications for mediums to send
+
+func PublishCron(db *gorm.DB) {
+	published, err := model.PublishDueEvents(db, time.Now())
+	if err != nil {
+		fmt.Fprintf(gin.DefaultWriter, "[Schrodinger's Box] Cannot publish scheduled events - %s\n", err.Error())
+	}
+	if len(published) != 0 && gin.IsDebugging() {
+		fmt.Fprintf(gin.DefaultWriter, "[Schrodinger's Box] Scheduled events published: %v\n", published)
+	}
+}
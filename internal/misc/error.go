@@ -1,6 +1,7 @@
 package misc
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 
@@ -31,7 +32,42 @@ func ReturnStandardError(ctx *gin.Context, status int, detail string) {
 		ReturnError(ctx, status, "you are not authorized to access this resource in this way", "error.forbidden", detail)
 	case http.StatusNotFound:
 		ReturnError(ctx, status, "requested or related resources cannot be found", "error.not_found", detail)
+	case http.StatusConflict:
+		ReturnError(ctx, status, "request conflicts with the current state of the resource", "error.conflict", detail)
 	case http.StatusInternalServerError:
 		ReturnError(ctx, status, "something unexpected happened at the server side", "error.internal", detail)
 	}
 }
+
+// ErrorSource points to the part of a request which caused an error
+type ErrorSource struct {
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+}
+
+// ErrorObject adds the source member, which is not supported by google/jsonapi, to JSON:API error objects
+type ErrorObject struct {
+	jsonapi.ErrorObject
+	Source *ErrorSource `json:"source,omitempty"`
+}
+
+// build an error object caused by a query parameter of the request
+func ParameterError(parameter string, detail string) *ErrorObject {
+	return &ErrorObject{
+		ErrorObject: jsonapi.ErrorObject{
+			Title:  "query parameter is invalid",
+			Code:   "error.invalid_parameter",
+			Status: strconv.Itoa(http.StatusBadRequest),
+			Detail: detail,
+		},
+		Source: &ErrorSource{Parameter: parameter},
+	}
+}
+
+func ReturnErrors(ctx *gin.Context, status int, errorObjects []*ErrorObject) {
+	ctx.Status(status)
+	if err := json.NewEncoder(ctx.Writer).Encode(map[string][]*ErrorObject{"errors": errorObjects}); err != nil {
+		http.Error(ctx.Writer, err.Error(), http.StatusInternalServerError)
+	}
+	ctx.Abort()
+}
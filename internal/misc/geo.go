@@ -0,0 +1,25 @@
+package misc
+
+import "math"
+
+// radius of the earth in meters, this is the same as the default of ST_Distance_Sphere in MySQL
+const EarthRadius = 6370986
+
+// approximate length of 1 degree of latitude in meters
+const MetersPerDegree = EarthRadius * math.Pi / 180
+
+// Distance calculates the great-circle distance in meters between two points using the haversine formula
+func Distance(latitude1, longitude1, latitude2, longitude2 float64) float64 {
+	phi1 := latitude1 * math.Pi / 180
+	phi2 := latitude2 * math.Pi / 180
+	deltaPhi := (latitude2 - latitude1) * math.Pi / 180
+	deltaLambda := (longitude2 - longitude1) * math.Pi / 180
+	a := math.Sin(deltaPhi/2)*math.Sin(deltaPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(deltaLambda/2)*math.Sin(deltaLambda/2)
+	return 2 * EarthRadius * math.Asin(math.Sqrt(a))
+}
+
+// ValidCoordinates checks whether latitude and longitude are within their ranges
+func ValidCoordinates(latitude, longitude float64) bool {
+	return latitude >= -90 && latitude <= 90 && longitude >= -180 && longitude <= 180
+}
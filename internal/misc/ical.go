@@ -0,0 +1,90 @@
+package misc
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// time format of UTC date-time values in iCalendar
+const icalTimeFormat = "20060102T150405Z"
+
+// ICalEvent holds the fields written into a VEVENT component
+type ICalEvent struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	// one of TENTATIVE, CONFIRMED and CANCELLED
+	Status  string
+	Begin   time.Time
+	End     time.Time
+	Updated time.Time
+}
+
+// WriteICalendar writes a VCALENDAR object (RFC 5545) with all events given to w
+func WriteICalendar(w io.Writer, name string, events []*ICalEvent) error {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Schrodinger's Box//Events//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + icalEscape(name),
+	}
+	for _, event := range events {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+icalEscape(event.UID),
+			"DTSTAMP:"+event.Updated.UTC().Format(icalTimeFormat),
+			"LAST-MODIFIED:"+event.Updated.UTC().Format(icalTimeFormat),
+			"DTSTART:"+event.Begin.UTC().Format(icalTimeFormat),
+			"DTEND:"+event.End.UTC().Format(icalTimeFormat),
+			"SUMMARY:"+icalEscape(event.Summary),
+		)
+		if event.Description != "" {
+			lines = append(lines, "DESCRIPTION:"+icalEscape(event.Description))
+		}
+		if event.Location != "" {
+			lines = append(lines, "LOCATION:"+icalEscape(event.Location))
+		}
+		if event.URL != "" {
+			// URL is of value type URI which is not escaped
+			lines = append(lines, "URL:"+event.URL)
+		}
+		if event.Status != "" {
+			lines = append(lines, "STATUS:"+event.Status)
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+	for _, line := range lines {
+		if _, err := io.WriteString(w, icalFold(line)+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escape special characters of TEXT values
+func icalEscape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// fold content lines longer than 75 octets, without breaking multi-byte characters
+func icalFold(line string) string {
+	var builder strings.Builder
+	length := 0
+	for _, r := range line {
+		size := len(string(r))
+		if length+size > 75 {
+			builder.WriteString("\r\n ")
+			// the leading space counts towards the length of the continuation line
+			length = 1
+		}
+		builder.WriteRune(r)
+		length += size
+	}
+	return builder.String()
+}
@@ -0,0 +1,51 @@
+package misc
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/google/jsonapi"
+)
+
+// number of pages needed to list all items
+func TotalPages(count int64, size int) int {
+	totalPages := int(count) / size
+	if int(count)%size != 0 {
+		totalPages++
+	}
+	return totalPages
+}
+
+// build JSON:API pagination links of a list endpoint (pages start from 0), links keep all query parameters other than page
+func PageLinks(path string, query url.Values, page int, totalPages int) map[string]*string {
+	linkQuery := url.Values{}
+	for key, values := range query {
+		linkQuery[key] = values
+	}
+	linkQuery.Del("page")
+	base := APIAbsolutePath(path) + "?"
+	if encoded := linkQuery.Encode(); encoded != "" {
+		base += encoded + "&"
+	}
+	base += "page="
+	firstString := base + "0"
+	lastString := base + "0"
+	if totalPages != 0 {
+		lastString = base + strconv.Itoa(totalPages-1)
+	}
+	var next, prev *string
+	if page < totalPages-1 {
+		nextString := base + strconv.Itoa(page+1)
+		next = &nextString
+	}
+	if page > 0 {
+		prevString := base + strconv.Itoa(page-1)
+		prev = &prevString
+	}
+	return map[string]*string{
+		jsonapi.KeyFirstPage:    &firstString,
+		jsonapi.KeyLastPage:     &lastString,
+		jsonapi.KeyNextPage:     next,
+		jsonapi.KeyPreviousPage: prev,
+	}
+}
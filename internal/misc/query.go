@@ -0,0 +1,205 @@
+package misc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// types of ListField, filter values are converted according to them
+const (
+	FieldInt    = "int"
+	FieldString = "string"
+	FieldTime   = "time"
+)
+
+// ListField describes a field which clients may filter or sort a list by
+type ListField struct {
+	// column name in the database, this MUST NOT come from user input
+	Column     string
+	Type       string
+	Filterable bool
+	Sortable   bool
+	// condition wrapping the filter of a column in another table, e.g. "id IN (SELECT ... WHERE %s)"
+	// Column has to be qualified with its table if this is set, fields with Subquery cannot be sorted
+	Subquery string
+}
+
+// ListQuery parses filter and sort parameters of list endpoints against a whitelist of fields and operators
+// filter format: filter=key,op,value (filter=key,value is the same as op=eq)
+// values of "in" and "between" are separated by "|", e.g. filter=type,in,talk|workshop
+// sort format: sort=key1,-key2 ("-" for descending order)
+type ListQuery struct {
+	// table of all columns in Fields
+	Table  string
+	Fields map[string]ListField
+}
+
+// SQL condition of each operator allowed
+var filterOperators = map[string]string{
+	"eq":      "%s = ?",
+	"ne":      "%s <> ?",
+	"lt":      "%s < ?",
+	"lte":     "%s <= ?",
+	"gt":      "%s > ?",
+	"gte":     "%s >= ?",
+	"in":      "%s IN ?",
+	"like":    "%s LIKE ?",
+	"between": "%s BETWEEN ? AND ?",
+}
+
+// symbolic operators accepted for backward compatibility
+var operatorAliases = map[string]string{
+	"=":  "eq",
+	"!=": "ne",
+	"<>": "ne",
+	"<":  "lt",
+	"<=": "lte",
+	">":  "gt",
+	">=": "gte",
+}
+
+// Filter adds a condition to tx for each filter parameter, all invalid parameters are reported at once
+func (query *ListQuery) Filter(tx *gorm.DB, filters []string) (*gorm.DB, []*ErrorObject) {
+	var errorObjects []*ErrorObject
+	for _, filter := range filters {
+		// values may contain commas so the split is limited
+		filterSlice := strings.SplitN(filter, ",", 3)
+		if len(filterSlice) == 2 {
+			filterSlice = []string{filterSlice[0], "eq", filterSlice[1]}
+		} else if len(filterSlice) != 3 {
+			errorObjects = append(errorObjects, ParameterError("filter", fmt.Sprintf("invalid filter format: '%s'", filter)))
+			continue
+		}
+		key, operator := filterSlice[0], filterSlice[1]
+		if alias, ok := operatorAliases[operator]; ok {
+			operator = alias
+		}
+		field, ok := query.Fields[key]
+		if !ok || !field.Filterable {
+			errorObjects = append(errorObjects, ParameterError("filter", fmt.Sprintf("invalid filter key: '%s'", key)))
+			continue
+		}
+		condition, ok := filterOperators[operator]
+		if !ok {
+			errorObjects = append(errorObjects, ParameterError("filter", fmt.Sprintf("invalid filter operator: '%s'", operator)))
+			continue
+		}
+		values, err := query.filterValues(field, operator, filterSlice[2])
+		if err != nil {
+			errorObjects = append(errorObjects, ParameterError("filter", fmt.Sprintf("invalid filter value of '%s': %s", key, err.Error())))
+			continue
+		}
+		condition = fmt.Sprintf(condition, query.column(field))
+		if field.Subquery != "" {
+			condition = fmt.Sprintf(field.Subquery, condition)
+		}
+		tx = tx.Where(condition, values...)
+	}
+	return tx, errorObjects
+}
+
+// Sort adds ORDER BY to tx according to the sort parameter, all invalid keys are reported at once
+func (query *ListQuery) Sort(tx *gorm.DB, sort string) (*gorm.DB, []*ErrorObject) {
+	var errorObjects []*ErrorObject
+	var columns []clause.OrderByColumn
+	for _, key := range strings.Split(sort, ",") {
+		desc := strings.HasPrefix(key, "-")
+		key = strings.TrimPrefix(key, "-")
+		if field, ok := query.Fields[key]; !ok || !field.Sortable || field.Subquery != "" {
+			errorObjects = append(errorObjects, ParameterError("sort", fmt.Sprintf("invalid sort key: '%s'", key)))
+		} else {
+			columns = append(columns, clause.OrderByColumn{
+				Column: clause.Column{Table: query.Table, Name: field.Column},
+				Desc:   desc,
+			})
+		}
+	}
+	if errorObjects != nil {
+		return tx, errorObjects
+	}
+	for _, column := range columns {
+		tx = tx.Order(column)
+	}
+	return tx, nil
+}
+
+func (query *ListQuery) column(field ListField) string {
+	if query.Table == "" || field.Subquery != "" {
+		return field.Column
+	}
+	return query.Table + "." + field.Column
+}
+
+// filterValues converts the raw value of a filter into arguments of its SQL condition
+func (query *ListQuery) filterValues(field ListField, operator string, raw string) ([]interface{}, error) {
+	var rawValues []string
+	switch operator {
+	case "in":
+		rawValues = strings.Split(raw, "|")
+	case "between":
+		if rawValues = strings.Split(raw, "|"); len(rawValues) != 2 {
+			return nil, fmt.Errorf("exactly 2 values are required by 'between'")
+		}
+	case "like":
+		if field.Type != FieldString {
+			return nil, fmt.Errorf("'like' can only be used on text fields")
+		}
+		// like matches a substring
+		rawValues = []string{LikePattern(raw)}
+	default:
+		rawValues = []string{raw}
+	}
+	values := make([]interface{}, 0, len(rawValues))
+	for _, rawValue := range rawValues {
+		switch field.Type {
+		case FieldInt:
+			if value, err := strconv.ParseInt(rawValue, 10, 64); err != nil {
+				return nil, fmt.Errorf("'%s' is not an integer", rawValue)
+			} else {
+				values = append(values, value)
+			}
+		case FieldTime:
+			if value, err := time.Parse(time.RFC3339, rawValue); err != nil {
+				return nil, fmt.Errorf("'%s' is not a RFC 3339 time", rawValue)
+			} else {
+				values = append(values, value)
+			}
+		default:
+			values = append(values, rawValue)
+		}
+	}
+	if operator == "in" {
+		// all values of "in" go into one argument
+		return []interface{}{values}, nil
+	}
+	return values, nil
+}
+
+// maximum number of words taken from a search query
+const MaxSearchTerms = 5
+
+// SearchTerms splits a search query into distinct lowercase words, words after MaxSearchTerms are ignored
+func SearchTerms(query string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		if terms = append(terms, term); len(terms) == MaxSearchTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// LikePattern builds a LIKE pattern matching any string containing text, wildcards in text are escaped
+func LikePattern(text string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text) + "%"
+}
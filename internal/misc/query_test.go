@@ -0,0 +1,167 @@
+package misc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var testListQuery = &ListQuery{
+	Table: "events",
+	Fields: map[string]ListField{
+		"id":         {Column: "id", Type: FieldInt, Filterable: true, Sortable: true},
+		"title":      {Column: "title", Type: FieldString, Filterable: true, Sortable: true},
+		"time_begin": {Column: "time_begin", Type: FieldTime, Filterable: true, Sortable: true},
+		"secret":     {Column: "secret", Type: FieldString},
+		"tag":        {Column: "tags.name", Type: FieldString, Filterable: true, Subquery: "events.id IN (SELECT event_id FROM event_tags JOIN tags ON tags.id = tag_id WHERE %s)"},
+	},
+}
+
+// conditions are inspected without a database, as gorm only builds SQL when a query is executed
+func testDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(nil, &gorm.Config{})
+	if err != nil {
+		t.Fatalf("cannot open gorm: %v", err)
+	}
+	return db
+}
+
+func whereExprs(tx *gorm.DB) []clause.Expression {
+	where, ok := tx.Statement.Clauses["WHERE"].Expression.(clause.Where)
+	if !ok {
+		return nil
+	}
+	return where.Exprs
+}
+
+func TestListQueryFilter(t *testing.T) {
+	begin := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		filter  string
+		want    clause.Expr
+		wantErr bool
+	}{
+		{
+			name:   "equal without operator",
+			filter: "title,Talk",
+			want:   clause.Expr{SQL: "events.title = ?", Vars: []interface{}{"Talk"}},
+		},
+		{
+			name:   "integer comparison",
+			filter: "id,gte,10",
+			want:   clause.Expr{SQL: "events.id >= ?", Vars: []interface{}{int64(10)}},
+		},
+		{
+			name:   "symbolic operator",
+			filter: "id,!=,3",
+			want:   clause.Expr{SQL: "events.id <> ?", Vars: []interface{}{int64(3)}},
+		},
+		{
+			name:   "value containing commas",
+			filter: "title,eq,a,b",
+			want:   clause.Expr{SQL: "events.title = ?", Vars: []interface{}{"a,b"}},
+		},
+		{
+			name:   "in",
+			filter: "id,in,1|2",
+			want:   clause.Expr{SQL: "events.id IN ?", Vars: []interface{}{[]interface{}{int64(1), int64(2)}}},
+		},
+		{
+			name:   "between times",
+			filter: "time_begin,between,2020-01-01T00:00:00Z|2020-01-01T00:00:00Z",
+			want:   clause.Expr{SQL: "events.time_begin BETWEEN ? AND ?", Vars: []interface{}{begin, begin}},
+		},
+		{
+			name:   "like escapes wildcards",
+			filter: "title,like,50%_off",
+			want:   clause.Expr{SQL: "events.title LIKE ?", Vars: []interface{}{`%50\%\_off%`}},
+		},
+		{
+			name:   "subquery",
+			filter: "tag,eq,music",
+			want:   clause.Expr{SQL: "events.id IN (SELECT event_id FROM event_tags JOIN tags ON tags.id = tag_id WHERE tags.name = ?)", Vars: []interface{}{"music"}},
+		},
+		{name: "unknown key", filter: "organizer_id,eq,1", wantErr: true},
+		{name: "key not filterable", filter: "secret,eq,1", wantErr: true},
+		{name: "column injection", filter: "id; DROP TABLE events,eq,1", wantErr: true},
+		{name: "unknown operator", filter: "id,regexp,1", wantErr: true},
+		{name: "missing value", filter: "id", wantErr: true},
+		{name: "not an integer", filter: "id,eq,1 OR 1=1", wantErr: true},
+		{name: "not a time", filter: "time_begin,gt,yesterday", wantErr: true},
+		{name: "between with one value", filter: "id,between,1", wantErr: true},
+		{name: "like on integer", filter: "id,like,1", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx, errorObjects := testListQuery.Filter(testDB(t), []string{test.filter})
+			if test.wantErr {
+				if len(errorObjects) != 1 {
+					t.Fatalf("Filter(%q) returned %d errors, want 1", test.filter, len(errorObjects))
+				} else if exprs := whereExprs(tx); len(exprs) != 0 {
+					t.Errorf("Filter(%q) added conditions %v despite the error", test.filter, exprs)
+				}
+				return
+			} else if len(errorObjects) != 0 {
+				t.Fatalf("Filter(%q) returned errors: %+v", test.filter, errorObjects[0])
+			}
+			exprs := whereExprs(tx)
+			if len(exprs) != 1 || !reflect.DeepEqual(exprs[0], test.want) {
+				t.Errorf("Filter(%q) = %#v, want %#v", test.filter, exprs, test.want)
+			}
+		})
+	}
+}
+
+func TestListQueryFilterReportsAllErrors(t *testing.T) {
+	tx, errorObjects := testListQuery.Filter(testDB(t), []string{"id,eq,1", "nope,eq,1", "id,eq,x", "title,Talk"})
+	if len(errorObjects) != 2 {
+		t.Errorf("Filter returned %d errors, want 2", len(errorObjects))
+	}
+	if exprs := whereExprs(tx); len(exprs) != 2 {
+		t.Errorf("Filter added %d conditions, want 2 for the valid filters", len(exprs))
+	}
+}
+
+func TestListQuerySort(t *testing.T) {
+	tests := []struct {
+		name    string
+		sort    string
+		want    []clause.OrderByColumn
+		wantErr int
+	}{
+		{
+			name: "ascending and descending",
+			sort: "time_begin,-id",
+			want: []clause.OrderByColumn{
+				{Column: clause.Column{Table: "events", Name: "time_begin"}},
+				{Column: clause.Column{Table: "events", Name: "id"}, Desc: true},
+			},
+		},
+		{name: "unknown key", sort: "-organizer_id", wantErr: 1},
+		{name: "key not sortable", sort: "secret", wantErr: 1},
+		{name: "subquery cannot be sorted", sort: "tag", wantErr: 1},
+		{name: "all invalid keys are reported", sort: "id,nope,secret", wantErr: 2},
+		{name: "injection", sort: "id desc; DROP TABLE events", wantErr: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tx, errorObjects := testListQuery.Sort(testDB(t), test.sort)
+			orderBy, _ := tx.Statement.Clauses["ORDER BY"].Expression.(clause.OrderBy)
+			if len(errorObjects) != test.wantErr {
+				t.Fatalf("Sort(%q) returned %d errors, want %d", test.sort, len(errorObjects), test.wantErr)
+			} else if test.wantErr != 0 {
+				if len(orderBy.Columns) != 0 {
+					t.Errorf("Sort(%q) added columns %v despite the errors", test.sort, orderBy.Columns)
+				}
+				return
+			}
+			if !reflect.DeepEqual(orderBy.Columns, test.want) {
+				t.Errorf("Sort(%q) = %#v, want %#v", test.sort, orderBy.Columns, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package misc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maximum number of occurrences a recurrence rule may expand to
+const MaxOccurrences = 100
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Recurrence is a subset of iCalendar (RFC 5545) RRULE
+// supported parts: FREQ (DAILY, WEEKLY or MONTHLY), INTERVAL, BYDAY (WEEKLY only), COUNT and UNTIL
+// example: FREQ=WEEKLY;BYDAY=TU;UNTIL=20201231T235959Z
+type Recurrence struct {
+	Freq     string
+	Interval int
+	ByDay    []time.Weekday
+	Count    int
+	Until    time.Time
+}
+
+func ParseRecurrence(rule string) (*Recurrence, error) {
+	recurrence := &Recurrence{Interval: 1}
+	rule = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+	for _, part := range strings.Split(rule, ";") {
+		keyValue := strings.SplitN(part, "=", 2)
+		if len(keyValue) != 2 || keyValue[1] == "" {
+			return nil, fmt.Errorf("invalid recurrence rule part '%s'", part)
+		}
+		switch keyValue[0] {
+		case "FREQ":
+			if keyValue[1] != "DAILY" && keyValue[1] != "WEEKLY" && keyValue[1] != "MONTHLY" {
+				return nil, fmt.Errorf("unsupported recurrence frequency '%s'", keyValue[1])
+			}
+			recurrence.Freq = keyValue[1]
+		case "INTERVAL":
+			if interval, err := strconv.Atoi(keyValue[1]); err != nil || interval <= 0 {
+				return nil, fmt.Errorf("invalid recurrence interval '%s'", keyValue[1])
+			} else {
+				recurrence.Interval = interval
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(keyValue[1], ",") {
+				if weekday, ok := weekdays[day]; !ok {
+					return nil, fmt.Errorf("invalid recurrence weekday '%s'", day)
+				} else {
+					recurrence.ByDay = append(recurrence.ByDay, weekday)
+				}
+			}
+		case "COUNT":
+			if count, err := strconv.Atoi(keyValue[1]); err != nil || count <= 0 {
+				return nil, fmt.Errorf("invalid recurrence count '%s'", keyValue[1])
+			} else {
+				recurrence.Count = count
+			}
+		case "UNTIL":
+			if until, err := time.Parse("20060102T150405Z", keyValue[1]); err == nil {
+				recurrence.Until = until
+			} else if until, err := time.ParseInLocation("20060102", keyValue[1], time.Local); err == nil {
+				// a date without time includes the whole day
+				recurrence.Until = until.AddDate(0, 0, 1).Add(-time.Second)
+			} else {
+				return nil, fmt.Errorf("invalid recurrence end '%s'", keyValue[1])
+			}
+		default:
+			return nil, fmt.Errorf("unsupported recurrence rule part '%s'", keyValue[0])
+		}
+	}
+	if recurrence.Freq == "" {
+		return nil, errors.New("recurrence frequency must be provided")
+	} else if (recurrence.Count == 0) == recurrence.Until.IsZero() {
+		return nil, errors.New("exactly one of recurrence count and end must be provided")
+	} else if recurrence.ByDay != nil && recurrence.Freq != "WEEKLY" {
+		return nil, errors.New("recurrence weekdays can only be used with weekly frequency")
+	}
+	// weekdays are visited from Monday (the default week start of RFC 5545)
+	sort.Slice(recurrence.ByDay, func(i, j int) bool {
+		return (recurrence.ByDay[i]+6)%7 < (recurrence.ByDay[j]+6)%7
+	})
+	return recurrence, nil
+}
+
+// Occurrences returns begin times of all occurrences, the first of which is always start itself
+// calendar arithmetic is done in the server's local time zone so that wall clock time is kept across DST changes
+func (recurrence *Recurrence) Occurrences(start time.Time) ([]time.Time, error) {
+	start = start.In(time.Local)
+	occurrences := []time.Time{start}
+	// done reports whether t is out of range of this recurrence
+	done := func(t time.Time) bool {
+		return (recurrence.Count != 0 && len(occurrences) >= recurrence.Count) ||
+			(!recurrence.Until.IsZero() && t.After(recurrence.Until))
+	}
+	for step := 1; ; step++ {
+		var candidates []time.Time
+		switch recurrence.Freq {
+		case "DAILY":
+			candidates = []time.Time{start.AddDate(0, 0, step*recurrence.Interval)}
+		case "WEEKLY":
+			if recurrence.ByDay == nil {
+				candidates = []time.Time{start.AddDate(0, 0, 7*step*recurrence.Interval)}
+				break
+			}
+			// weeks are counted from the Monday of the week start falls in
+			monday := start.AddDate(0, 0, -int((start.Weekday()+6)%7))
+			// the week of start itself has to be visited as well
+			week := monday.AddDate(0, 0, 7*(step-1)*recurrence.Interval)
+			for _, weekday := range recurrence.ByDay {
+				if candidate := week.AddDate(0, 0, int((weekday+6)%7)); candidate.After(start) {
+					candidates = append(candidates, candidate)
+				}
+			}
+		case "MONTHLY":
+			candidate := start.AddDate(0, step*recurrence.Interval, 0)
+			if candidate.Day() == start.Day() {
+				// months without such a day (e.g. 31st) are skipped
+				candidates = []time.Time{candidate}
+			}
+		}
+		for _, candidate := range candidates {
+			if done(candidate) {
+				return occurrences, nil
+			} else if len(occurrences) >= MaxOccurrences {
+				return nil, fmt.Errorf("recurrence cannot have more than %d occurrences", MaxOccurrences)
+			}
+			occurrences = append(occurrences, candidate)
+		}
+		if len(candidates) == 0 && step > 12*MaxOccurrences {
+			// guard against rules which never produce another occurrence
+			return occurrences, nil
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package misc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		want    *Recurrence
+		wantErr bool
+	}{
+		{
+			name: "weekly with count",
+			rule: "FREQ=WEEKLY;COUNT=3",
+			want: &Recurrence{Freq: "WEEKLY", Interval: 1, Count: 3},
+		},
+		{
+			name: "prefix, lower case and spaces",
+			rule: " rrule:freq=daily;interval=2;count=5 ",
+			want: &Recurrence{Freq: "DAILY", Interval: 2, Count: 5},
+		},
+		{
+			name: "weekdays are sorted from Monday",
+			rule: "FREQ=WEEKLY;BYDAY=SU,TU,MO;COUNT=4",
+			want: &Recurrence{Freq: "WEEKLY", Interval: 1, ByDay: []time.Weekday{time.Monday, time.Tuesday, time.Sunday}, Count: 4},
+		},
+		{
+			name: "until with time",
+			rule: "FREQ=MONTHLY;UNTIL=20201231T235959Z",
+			want: &Recurrence{Freq: "MONTHLY", Interval: 1, Until: time.Date(2020, 12, 31, 23, 59, 59, 0, time.UTC)},
+		},
+		{
+			name: "until date includes the whole day",
+			rule: "FREQ=DAILY;UNTIL=20201231",
+			want: &Recurrence{Freq: "DAILY", Interval: 1, Until: time.Date(2020, 12, 31, 23, 59, 59, 0, time.Local)},
+		},
+		{name: "missing frequency", rule: "COUNT=3", wantErr: true},
+		{name: "unsupported frequency", rule: "FREQ=YEARLY;COUNT=3", wantErr: true},
+		{name: "neither count nor until", rule: "FREQ=DAILY", wantErr: true},
+		{name: "both count and until", rule: "FREQ=DAILY;COUNT=3;UNTIL=20201231", wantErr: true},
+		{name: "zero interval", rule: "FREQ=DAILY;INTERVAL=0;COUNT=3", wantErr: true},
+		{name: "negative count", rule: "FREQ=DAILY;COUNT=-1", wantErr: true},
+		{name: "invalid weekday", rule: "FREQ=WEEKLY;BYDAY=XX;COUNT=3", wantErr: true},
+		{name: "weekdays with daily frequency", rule: "FREQ=DAILY;BYDAY=MO;COUNT=3", wantErr: true},
+		{name: "invalid until", rule: "FREQ=DAILY;UNTIL=tomorrow", wantErr: true},
+		{name: "unsupported part", rule: "FREQ=DAILY;COUNT=3;BYMONTH=1", wantErr: true},
+		{name: "part without value", rule: "FREQ=DAILY;COUNT=", wantErr: true},
+		{name: "empty rule", rule: "", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseRecurrence(test.rule)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRecurrence(%q) = %+v, want error", test.rule, got)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("ParseRecurrence(%q) returned error: %v", test.rule, err)
+			}
+			if !got.Until.Equal(test.want.Until) {
+				t.Errorf("Until = %v, want %v", got.Until, test.want.Until)
+			}
+			got.Until, test.want.Until = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseRecurrence(%q) = %+v, want %+v", test.rule, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRecurrenceOccurrences(t *testing.T) {
+	// 2020-01-06 is a Monday
+	start := time.Date(2020, 1, 6, 18, 30, 0, 0, time.Local)
+	tests := []struct {
+		name    string
+		rule    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "daily with interval",
+			rule: "FREQ=DAILY;INTERVAL=2;COUNT=3",
+			want: []string{"2020-01-06", "2020-01-08", "2020-01-10"},
+		},
+		{
+			name: "weekly on several days",
+			rule: "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=4",
+			want: []string{"2020-01-06", "2020-01-09", "2020-01-13", "2020-01-16"},
+		},
+		{
+			name: "fortnightly until a date",
+			rule: "FREQ=WEEKLY;INTERVAL=2;UNTIL=20200203",
+			want: []string{"2020-01-06", "2020-01-20", "2020-02-03"},
+		},
+		{
+			name: "monthly",
+			rule: "FREQ=MONTHLY;COUNT=3",
+			want: []string{"2020-01-06", "2020-02-06", "2020-03-06"},
+		},
+		{
+			name:    "too many occurrences",
+			rule:    "FREQ=DAILY;COUNT=1000",
+			wantErr: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recurrence, err := ParseRecurrence(test.rule)
+			if err != nil {
+				t.Fatalf("ParseRecurrence(%q) returned error: %v", test.rule, err)
+			}
+			occurrences, err := recurrence.Occurrences(start)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("Occurrences() returned %d occurrences, want error", len(occurrences))
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("Occurrences() returned error: %v", err)
+			}
+			got := make([]string, 0, len(occurrences))
+			for _, occurrence := range occurrences {
+				if occurrence.Hour() != 18 || occurrence.Minute() != 30 {
+					t.Errorf("occurrence %v does not keep the wall clock time of start", occurrence)
+				}
+				got = append(got, occurrence.Format("2006-01-02"))
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Occurrences() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRecurrenceOccurrencesSkipsMissingDays(t *testing.T) {
+	start := time.Date(2020, 1, 31, 10, 0, 0, 0, time.Local)
+	recurrence, err := ParseRecurrence("FREQ=MONTHLY;COUNT=3")
+	if err != nil {
+		t.Fatalf("ParseRecurrence returned error: %v", err)
+	}
+	occurrences, err := recurrence.Occurrences(start)
+	if err != nil {
+		t.Fatalf("Occurrences() returned error: %v", err)
+	}
+	want := []string{"2020-01-31", "2020-03-31", "2020-05-31"}
+	for i, occurrence := range occurrences {
+		if i >= len(want) || occurrence.Format("2006-01-02") != want[i] {
+			t.Fatalf("Occurrences() = %v, want %v", occurrences, want)
+		}
+	}
+	if len(occurrences) != len(want) {
+		t.Fatalf("Occurrences() = %v, want %v", occurrences, want)
+	}
+}
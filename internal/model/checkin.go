@@ -0,0 +1,135 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+ * check-in model - log of attempts to check in to an event with a check-in code
+ * codes are shown by event staff as QR codes and rotate every CheckinCodePeriod
+ * format of a code: <event ID>.<period number>.<nonce>.<signature>
+ * the signature is HMAC-SHA256 of the other parts keyed with the check-in secret of the event
+ */
+type EventCheckin struct {
+	ID      uint   `jsonapi:"primary,event_checkin" gorm:"primarykey"`
+	EventID *uint  `gorm:"not null;index"`
+	Event   *Event `jsonapi:"relation,event,omitempty" gorm:"PRELOAD:false"`
+	UserID  *uint  `gorm:"not null;index"`
+	User    *User  `jsonapi:"relation,user,omitempty" gorm:"PRELOAD:false"`
+	// signup checked in, this is empty if the user has not signed up
+	SignupID *uint `jsonapi:"attr,signup_id,omitempty"`
+
+	// code submitted by the user, this is not logged in the database
+	Code *string `jsonapi:"attr,code,omitempty" gorm:"-"`
+	// Result codes:
+	// - accepted      : the signup has been marked as attended
+	// - invalid       : the code is malformed or its signature does not match
+	// - expired       : the code is no longer valid
+	// - wrong_event   : the code is generated for another event
+	// - not_signed_up : the user does not hold a confirmed signup of the event
+	// - checked_in    : the user has already checked in, codes replayed after a check-in are rejected by this
+	// - closed        : check-in of the event is not open
+	Result *string `jsonapi:"attr,result" gorm:"not null"`
+
+	DBTime
+}
+
+// codes rotate every period, a code is accepted until the end of the period after the one it is generated in
+const CheckinCodePeriod = 30 * time.Second
+
+// check-in opens this long before an event begins and closes when it ends
+const CheckinOpenBefore = time.Hour
+
+// messages of these errors are used as result codes of EventCheckin
+var (
+	ErrCheckinCodeInvalid    = errors.New("invalid")
+	ErrCheckinCodeExpired    = errors.New("expired")
+	ErrCheckinCodeWrongEvent = errors.New("wrong_event")
+)
+
+// create the check-in secret of this event if it does not exist, the event has to be locked in the transaction
+// otherwise concurrent requests may replace the secret and invalidate codes generated with the previous one
+func (event *Event) EnsureCheckinSecret(db *gorm.DB) error {
+	if event.CheckinSecret != nil {
+		return nil
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return err
+	} else if err := db.Model(event).Update("checkin_secret", secret).Error; err != nil {
+		return err
+	}
+	event.CheckinSecret = &secret
+	return nil
+}
+
+// generate the check-in code of the current period, the check-in secret must have been created by EnsureCheckinSecret
+func (event *Event) CheckinCode(now time.Time) (string, time.Time, error) {
+	if event.CheckinSecret == nil {
+		return "", time.Time{}, errors.New("check-in secret of this event has not been created")
+	}
+	nonce, err := randomHex(8)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	period := now.Unix() / int64(CheckinCodePeriod/time.Second)
+	payload := fmt.Sprintf("%d.%d.%s", event.ID, period, nonce)
+	expiresAt := time.Unix((period+2)*int64(CheckinCodePeriod/time.Second), 0)
+	return payload + "." + event.signCheckin(payload), expiresAt, nil
+}
+
+// verify a check-in code submitted for this event
+func (event *Event) VerifyCheckinCode(code string, now time.Time) error {
+	parts := strings.Split(code, ".")
+	if len(parts) != 4 {
+		return ErrCheckinCodeInvalid
+	}
+	eventID, idErr := strconv.ParseUint(parts[0], 10, 64)
+	period, periodErr := strconv.ParseInt(parts[1], 10, 64)
+	if idErr != nil || periodErr != nil || parts[2] == "" {
+		return ErrCheckinCodeInvalid
+	} else if uint(eventID) != event.ID {
+		return ErrCheckinCodeWrongEvent
+	} else if event.CheckinSecret == nil {
+		return ErrCheckinCodeInvalid
+	}
+	signature := event.signCheckin(strings.Join(parts[:3], "."))
+	if !hmac.Equal([]byte(signature), []byte(parts[3])) {
+		return ErrCheckinCodeInvalid
+	}
+	current := now.Unix() / int64(CheckinCodePeriod/time.Second)
+	if period > current || current-period > 1 {
+		return ErrCheckinCodeExpired
+	}
+	return nil
+}
+
+// whether users can check in to this event at the time given
+func (event *Event) CheckinOpen(now time.Time) bool {
+	return event.IsActive() && !now.Before(event.TimeBegin.Add(-CheckinOpenBefore)) && !now.After(*event.TimeEnd)
+}
+
+func (event *Event) signCheckin(payload string) string {
+	mac := hmac.New(sha256.New, []byte(*event.CheckinSecret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func randomHex(size int) (string, error) {
+	bytes := make([]byte, size)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testCheckinEvent(id uint, secret string) *Event {
+	event := &Event{ID: id}
+	if secret != "" {
+		event.CheckinSecret = &secret
+	}
+	return event
+}
+
+func TestVerifyCheckinCode(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 10, 0, time.UTC)
+	event := testCheckinEvent(42, "secret")
+	code, expiresAt, err := event.CheckinCode(now)
+	if err != nil {
+		t.Fatalf("CheckinCode returned error: %v", err)
+	} else if !expiresAt.After(now.Add(CheckinCodePeriod)) {
+		t.Errorf("code expires at %v, want after the end of the next period", expiresAt)
+	}
+	parts := strings.Split(code, ".")
+	tamperedPeriod := strings.Join([]string{parts[0], "1", parts[2], parts[3]}, ".")
+	tamperedNonce := strings.Join([]string{parts[0], parts[1], "00", parts[3]}, ".")
+	tests := []struct {
+		name    string
+		event   *Event
+		code    string
+		now     time.Time
+		wantErr error
+	}{
+		{name: "current period", event: event, code: code, now: now},
+		{name: "next period", event: event, code: code, now: now.Add(CheckinCodePeriod)},
+		{name: "two periods later", event: event, code: code, now: now.Add(2 * CheckinCodePeriod), wantErr: ErrCheckinCodeExpired},
+		{name: "generated in the future", event: event, code: code, now: now.Add(-CheckinCodePeriod), wantErr: ErrCheckinCodeExpired},
+		{name: "another event", event: testCheckinEvent(43, "secret"), code: code, now: now, wantErr: ErrCheckinCodeWrongEvent},
+		{name: "another secret", event: testCheckinEvent(42, "other"), code: code, now: now, wantErr: ErrCheckinCodeInvalid},
+		{name: "secret not created", event: testCheckinEvent(42, ""), code: code, now: now, wantErr: ErrCheckinCodeInvalid},
+		{name: "tampered period", event: event, code: tamperedPeriod, now: now, wantErr: ErrCheckinCodeInvalid},
+		{name: "tampered nonce", event: event, code: tamperedNonce, now: now, wantErr: ErrCheckinCodeInvalid},
+		{name: "missing signature", event: event, code: strings.Join(parts[:3], "."), now: now, wantErr: ErrCheckinCodeInvalid},
+		{name: "empty nonce", event: event, code: strings.Join([]string{parts[0], parts[1], "", parts[3]}, "."), now: now, wantErr: ErrCheckinCodeInvalid},
+		{name: "not a number", event: event, code: "x.y.z.w", now: now, wantErr: ErrCheckinCodeInvalid},
+		{name: "empty code", event: event, code: "", now: now, wantErr: ErrCheckinCodeInvalid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.event.VerifyCheckinCode(test.code, test.now); !errors.Is(err, test.wantErr) {
+				t.Errorf("VerifyCheckinCode returned error %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckinCodeRequiresSecret(t *testing.T) {
+	if _, _, err := testCheckinEvent(42, "").CheckinCode(time.Now()); err == nil {
+		t.Error("CheckinCode succeeded without a secret")
+	}
+}
+
+func TestCheckinCodesAreUnique(t *testing.T) {
+	event := testCheckinEvent(42, "secret")
+	now := time.Now()
+	first, _, err := event.CheckinCode(now)
+	if err != nil {
+		t.Fatalf("CheckinCode returned error: %v", err)
+	}
+	second, _, err := event.CheckinCode(now)
+	if err != nil {
+		t.Fatalf("CheckinCode returned error: %v", err)
+	} else if first == second {
+		t.Errorf("codes generated in the same period share the nonce: %s", first)
+	}
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrSignupNotOpen    = errors.New("signup of this event has not opened yet")
+	ErrSignupClosed     = errors.New("signup of this event has closed")
+	ErrWithdrawalClosed = errors.New("signups of this event can no longer be withdrawn")
+)
+
+// the time signup closes, which is the begin time of the event unless it is set by the organizer
+func (event *Event) SignupClosesAt() time.Time {
+	if event.SignupCloseAt != nil {
+		return *event.SignupCloseAt
+	}
+	return *event.TimeBegin
+}
+
+// the time after which signups cannot be withdrawn, which is the begin time of the event unless it is set by the organizer
+func (event *Event) WithdrawDeadline() time.Time {
+	if event.WithdrawBy != nil {
+		return *event.WithdrawBy
+	}
+	return *event.TimeBegin
+}
+
+// check whether users can sign up at the time given, an error telling the reason is returned if they cannot
+func (event *Event) CheckSignupOpen(now time.Time) error {
+	if event.SignupOpenAt != nil && now.Before(*event.SignupOpenAt) {
+		return ErrSignupNotOpen
+	} else if !now.Before(event.SignupClosesAt()) {
+		return ErrSignupClosed
+	}
+	return nil
+}
+
+// check whether users can withdraw their confirmed signups at the time given
+// waitlisted and pending signups hold no place and can be withdrawn at any time
+func (event *Event) CheckWithdrawOpen(now time.Time) error {
+	if now.After(event.WithdrawDeadline()) {
+		return ErrWithdrawalClosed
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/jsonapi"
+	"github.com/mitchellh/mapstructure"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	"gorm.io/gorm"
@@ -21,40 +22,188 @@ type Event struct {
 	Title     *string    `jsonapi:"attr,title" gorm:"not null"`
 	TimeBegin *time.Time `jsonapi:"attr,time_begin,iso8601" gorm:"not null"`
 	TimeEnd   *time.Time `jsonapi:"attr,time_end,iso8601" gorm:"not null"`
-	// This is either OnlineLocation or PhysicalLocation
+	// This is either OnlineLocation, PhysicalLocation or HybridLocation
 	LocationJSON *string     `gorm:"not null"`
 	Location     interface{} `jsonapi:"attr,location" gorm:"-"`
 	Type         *string     `jsonapi:"attr,type" gorm:"not null"`
 	Images       []*File     `jsonapi:"relation,images,omitempty" gorm:"polymorphic:Link"`
+	Tags         []*Tag      `jsonapi:"relation,tags,omitempty" gorm:"many2many:event_tags"`
+	// registration questions answered by users when they sign up, this is a list of *EventQuestion
+	QuestionsJSON *string     `jsonapi:"-"`
+	Questions     interface{} `jsonapi:"attr,questions,omitempty" gorm:"-"`
+	// maximum number of confirmed signups, there is no limit if this is empty or 0
+	Capacity *uint `jsonapi:"attr,capacity,omitempty"`
+	// maximum number of confirmed signups attending a hybrid event in person or online, in addition to Capacity
+	CapacityInPerson *uint `jsonapi:"attr,capacity_in_person,omitempty"`
+	CapacityOnline   *uint `jsonapi:"attr,capacity_online,omitempty"`
+	// number of named guests each user can bring, guests take places of the event together with the user
+	MaxGuests *uint `jsonapi:"attr,max_guests,omitempty"`
+	// one of EventStatuses, events are cancelled through the cancel action instead of being deleted
+	Status       *string `jsonapi:"attr,status" gorm:"not null;default:'scheduled';index"`
+	CancelReason *string `jsonapi:"attr,cancel_reason,omitempty"`
+	// drafts are only visible to organizers, they are published by organizers or automatically at PublishAt
+	PublishStatus *string    `jsonapi:"attr,publish_status" gorm:"not null;default:'published';index"`
+	PublishAt     *time.Time `jsonapi:"attr,publish_at,iso8601,omitempty" gorm:"index"`
+	PublishedAt   *time.Time `jsonapi:"attr,published_at,iso8601,omitempty"`
+	// signup is open from SignupOpenAt (immediately if empty) until SignupCloseAt (TimeBegin if empty)
+	SignupOpenAt  *time.Time `jsonapi:"attr,signup_open_at,iso8601,omitempty"`
+	SignupCloseAt *time.Time `jsonapi:"attr,signup_close_at,iso8601,omitempty"`
+	// confirmed signups cannot be withdrawn after WithdrawBy (TimeBegin if empty)
+	WithdrawBy *time.Time `jsonapi:"attr,withdraw_by,iso8601,omitempty"`
+	// signups of events requiring approval are pending until they are approved by organizers
+	RequiresApproval *bool `jsonapi:"attr,requires_approval" gorm:"not null;default:false"`
+	// places of lottery events are allocated by a draw at LotteryDrawAt, signups are pending until then
+	// users who have lost previous draws are given higher chances if LotteryWeighted is true
+	LotteryDrawAt   *time.Time `jsonapi:"attr,lottery_draw_at,iso8601,omitempty" gorm:"index"`
+	LotteryWeighted *bool      `jsonapi:"attr,lottery_weighted,omitempty"`
+	// the seed is published after the draw so that anyone can verify the result, see lottery.go
+	LotteryDrawnAt *time.Time `jsonapi:"attr,lottery_drawn_at,iso8601,omitempty"`
+	LotterySeed    *string    `jsonapi:"attr,lottery_seed,omitempty"`
+	// one of EventVisibilities, only public events are listed
+	Visibility *string `jsonapi:"attr,visibility" gorm:"not null;default:'public';index"`
+	// key signing check-in codes of this event, it is created when a code is generated for the first time
+	CheckinSecret *string `jsonapi:"-"`
+	// coordinates copied from a geocoded PhysicalLocation for searching events nearby
+	Latitude  *float64 `gorm:"index"`
+	Longitude *float64
 
 	OrganizerID  *uint          `gorm:"not null"`
 	Organizer    *User          `jsonapi:"relation,organizer,omitempty"`
 	EventSignups []*EventSignup `jsonapi:"relation,event_signups,omitempty"`
+	Staff        []*EventStaff  `jsonapi:"relation,staff,omitempty"`
+	// this is only set for occurrences of an event series
+	SeriesID *uint        `gorm:"index"`
+	Series   *EventSeries `jsonapi:"relation,series,omitempty"`
+
+	// number of places taken by signups (users and their guests) of each status
+	// this is only filled by LoadSignups and will not be logged in the database
+	SignupCounts map[string]int `jsonapi:"-" gorm:"-"`
+	// number of places taken by confirmed signups of each attendance mode, this is only filled by LoadSignups
+	ModeCounts map[string]int `jsonapi:"-" gorm:"-"`
+	// aggregates of review scores, this is only filled by LoadSignups
+	Rating *RatingSummary `jsonapi:"-" gorm:"-"`
+	// distance in meters from the point searched, this is only filled when searching events nearby
+	Distance *float64 `jsonapi:"-" gorm:"-"`
+	// set by HideLocationFrom, the location shown is not the one stored
+	locationHidden bool
 
 	DBTime
 }
 
+// signups of these status codes take up places of an event
+var ConfirmedStatuses = []string{SignupCreated, SignupAttended, SignupNoShow, SignupReviewed}
+
+// status codes of events
+const (
+	EventScheduled = "scheduled"
+	// the event will take place at a time to be announced
+	EventPostponed = "postponed"
+	EventCancelled = "cancelled"
+	EventCompleted = "completed"
+)
+
+var EventStatuses = []string{EventScheduled, EventPostponed, EventCancelled, EventCompleted}
+
 func (event *Event) JSONAPILinks() *jsonapi.Links {
 	return &jsonapi.Links{
 		"self": viper.GetString("domain") + "/api/event/" + fmt.Sprint(event.ID),
 	}
 }
 
+func (event *Event) JSONAPIMeta() *jsonapi.Meta {
+	meta := jsonapi.Meta{}
+	if event.SignupCounts != nil {
+		confirmed := 0
+		for _, status := range ConfirmedStatuses {
+			confirmed += event.SignupCounts[status]
+		}
+		meta["confirmed_count"] = confirmed
+		meta["waitlisted_count"] = event.SignupCounts["waitlisted"]
+		if event.NeedsApproval() || event.IsLottery() {
+			meta["pending_count"] = event.SignupCounts[SignupPending]
+		}
+	}
+	if event.ModeCounts != nil && event.IsHybrid() {
+		meta["confirmed_in_person_count"] = event.ModeCounts[AttendInPerson]
+		meta["confirmed_online_count"] = event.ModeCounts[AttendOnline]
+	}
+	// deadlines in effect, which default to the begin time of the event if they are not set
+	if event.TimeBegin != nil {
+		meta["signup_closes_at"] = event.SignupClosesAt().Format(time.RFC3339)
+		meta["withdraw_deadline"] = event.WithdrawDeadline().Format(time.RFC3339)
+	}
+	if event.Rating != nil {
+		meta["rating"] = event.Rating
+	}
+	if event.Distance != nil {
+		meta["distance"] = *event.Distance
+	}
+	if len(meta) == 0 {
+		return nil
+	}
+	return &meta
+}
+
 func (event *Event) JSONAPIRelationshipLinks(relation string) *jsonapi.Links {
 	if relation == "organizer" {
 		return &jsonapi.Links{
 			"related": misc.APIAbsolutePath("/user/" + fmt.Sprint(*event.OrganizerID)),
 		}
+	} else if relation == "series" && event.SeriesID != nil {
+		return &jsonapi.Links{
+			"related": misc.APIAbsolutePath("/event_series/" + fmt.Sprint(*event.SeriesID)),
+		}
+	}
+	return nil
+}
+
+func (event *Event) BeforeCreate(tx *gorm.DB) error {
+	if event.Status == nil {
+		status := EventScheduled
+		event.Status = &status
+	}
+	if event.Visibility == nil {
+		visibility := EventPublic
+		event.Visibility = &visibility
+	}
+	if event.PublishStatus == nil {
+		publishStatus := EventPublished
+		event.PublishStatus = &publishStatus
+	}
+	if *event.PublishStatus == EventPublished && event.PublishedAt == nil {
+		now := time.Now()
+		event.PublishedAt = &now
 	}
 	return nil
 }
 
 func (event *Event) BeforeSave(tx *gorm.DB) error {
+	if event.locationHidden {
+		return errors.New("event cannot be saved with its location details hidden")
+	}
 	// Marshal Location object into LocationJSON
 	jsonByteSlice, err := json.Marshal(event.Location)
 	jsonString := string(jsonByteSlice)
 	event.LocationJSON = &jsonString
-	return errors.WithStack(err)
+	// keep coordinates in sync with the location
+	event.Latitude, event.Longitude = nil, nil
+	if location := PhysicalLocationOf(event.Location); location != nil {
+		event.Latitude, event.Longitude = location.Latitude, location.Longitude
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// Marshal questions into QuestionsJSON, which is left empty if there is no question
+	event.QuestionsJSON = nil
+	if questions := event.QuestionList(); len(questions) != 0 {
+		questionsJSON, err := json.Marshal(questions)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		questionsString := string(questionsJSON)
+		event.QuestionsJSON = &questionsString
+	}
+	return nil
 }
 
 func (event *Event) AfterSave(tx *gorm.DB) error {
@@ -63,25 +212,195 @@ func (event *Event) AfterSave(tx *gorm.DB) error {
 
 func (event *Event) AfterFind(tx *gorm.DB) error {
 	// Unmarshal LocationJSON into Location object
-	err := json.Unmarshal([]byte(*event.LocationJSON), &event.Location)
-	return errors.WithStack(err)
+	if err := json.Unmarshal([]byte(*event.LocationJSON), &event.Location); err != nil {
+		return errors.WithStack(err)
+	}
+	// Unmarshal QuestionsJSON into a list of questions
+	event.Questions = nil
+	if event.QuestionsJSON != nil {
+		var questions []*EventQuestion
+		if err := json.Unmarshal([]byte(*event.QuestionsJSON), &questions); err != nil {
+			return errors.WithStack(err)
+		}
+		event.Questions = questions
+	}
+	return nil
 }
 
-func (event *Event) AfterDelete(tx *gorm.DB) error {
-	// delete all linked event signup records
-	var eventSignups []*EventSignup
-	if err := tx.Model(event).Association("EventSignups").Find(&eventSignups); err != nil {
+func (event *Event) BeforeDelete(tx *gorm.DB) error {
+	// signup records are kept as history of users, events with signups have to be cancelled instead
+	var signups int64
+	if err := tx.Session(&gorm.Session{}).Model(&EventSignup{}).Where("event_id = ?", event.ID).Count(&signups).Error; err != nil {
+		return err
+	} else if signups != 0 {
+		return errors.New("event with signups cannot be deleted")
+	}
+	return nil
+}
+
+func (event *Event) LoadSignups(db *gorm.DB) error {
+	// withdrawn and rejected signups are only kept as history and not shown
+	if err := db.Model(event).Preload("User").Association("EventSignups").Find(&event.EventSignups, "status NOT IN ?", UnlistedStatuses); err != nil {
+		return err
+	}
+	event.SignupCounts = make(map[string]int)
+	event.ModeCounts = make(map[string]int)
+	event.Rating = NewRatingSummary()
+	for _, signup := range event.EventSignups {
+		event.SignupCounts[*signup.Status] += int(signup.Places())
+		if signup.AttendanceMode != nil && isConfirmedStatus(*signup.Status) {
+			event.ModeCounts[*signup.AttendanceMode] += int(signup.Places())
+		}
+		if *signup.Status == "reviewed" && signup.ReviewScore != nil && signup.ReviewHiddenAt == nil {
+			event.Rating.Add(*signup.ReviewScore, 1)
+		}
+	}
+	return nil
+}
+
+// whether the event is still going to take place, only active events accept signups and send reminders
+func (event *Event) IsActive() bool {
+	return event.Status == nil || *event.Status == EventScheduled || *event.Status == EventPostponed
+}
+
+// cancel this event, pending reminders are cancelled and all users signed up are notified
+// signup records are kept so that the event stays in their history
+func (event *Event) Cancel(db *gorm.DB, reason *string) error {
+	status := EventCancelled
+	event.Status = &status
+	event.CancelReason = reason
+	if err := db.Model(event).Updates(map[string]interface{}{"status": status, "cancel_reason": reason}).Error; err != nil {
 		return err
+	} else if err := event.CancelReminders(db); err != nil {
+		return err
+	}
+	text := fmt.Sprintf("Event \"%s\" (%s) has been cancelled by its organizer.",
+		*event.Title, event.TimeBegin.Format(NotificationTimeFormat))
+	if reason != nil && *reason != "" {
+		text += "\nReason: " + *reason
 	}
-	if len(eventSignups) == 0 {
+	return event.notifySignups(db, []string{SignupCreated, SignupWaitlisted, SignupPending}, "EventUpdate", text, time.Now())
+}
+
+// whether a limit is set on the number of confirmed signups
+func (event *Event) HasCapacity() bool {
+	return event.Capacity != nil && *event.Capacity != 0
+}
+
+// promote the earliest waitlisted signups until all places of this event are taken, promoted users are notified
+func (event *Event) PromoteWaitlist(db *gorm.DB) error {
+	if !event.IsActive() {
+		return nil
+	}
+	count, err := event.countPlaces(db)
+	if err != nil {
+		return err
+	} else if event.HasCapacity() && count.total >= int64(*event.Capacity) {
 		return nil
-	} else {
-		return tx.Delete(&eventSignups).Error
 	}
+	var waitlisted []*EventSignup
+	if err := db.Preload("User").
+		Preload("User.Subscription").
+		Where("event_id = ? AND status = ?", event.ID, "waitlisted").
+		// users who have lost the lottery are promoted in the order drawn, before those who signed up after the draw
+		Order("lottery_rank IS NULL, lottery_rank asc, created_at asc, id asc").
+		Find(&waitlisted).Error; err != nil {
+		return err
+	}
+	for _, signup := range waitlisted {
+		// signups are skipped if their attendance mode is full or their guests do not fit
+		// later ones of the other mode or with fewer guests may still be promoted
+		if !event.hasPlace(count, signup.Mode(), signup.Places()) {
+			if event.HasCapacity() && count.total >= int64(*event.Capacity) {
+				break
+			}
+			continue
+		}
+		if err := signup.Transition(db, SignupPromote, nil); err != nil {
+			return err
+		}
+		count.total += signup.Places()
+		count.modes[signup.Mode()] += signup.Places()
+		text := fmt.Sprintf("Good news! A place of \"%s\" (%s) has been released and you are now confirmed to attend.",
+			*event.Title, event.TimeBegin.Format(NotificationTimeFormat))
+		if err := signup.User.CreateNotificationAll(db, "EventUpdate", text, time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (event *Event) LoadSignups(db *gorm.DB) error {
-	return db.Model(event).Preload("User").Association("EventSignups").Find(&event.EventSignups)
+// create notification for all users holding an active signup record of this event
+func (event *Event) NotifySignups(db *gorm.DB, action string, text string, sendTime time.Time) error {
+	return event.notifySignups(db, []string{"created"}, action, text, sendTime)
+}
+
+func (event *Event) notifySignups(db *gorm.DB, statuses []string, action string, text string, sendTime time.Time) error {
+	var eventSignups []*EventSignup
+	if err := db.Preload("User").
+		Preload("User.Subscription").
+		Where("event_id = ? AND status IN ?", event.ID, statuses).
+		Find(&eventSignups).Error; err != nil {
+		return err
+	}
+	for _, signup := range eventSignups {
+		if err := signup.User.CreateNotificationAll(db, action, text, sendTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schedule EventReminder batches for this event, replacing those which have not been generated yet
+// reminders whose sending time has already passed are skipped
+func (event *Event) ScheduleReminders(db *gorm.DB) error {
+	for action, offset := range ReminderOffsets {
+		if err := CancelBatches(db, BuildLinkID(event, action)); err != nil {
+			return err
+		} else if time.Now().After(event.TimeBegin.Add(-offset)) {
+			continue
+		}
+		template := ReminderTemplates[action]
+		batch := &NotificationBatch{Template: &template}
+		if err := batch.Create(db, event, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cancel all EventReminder batches of this event which have not been generated yet
+func (event *Event) CancelReminders(db *gorm.DB) error {
+	for action := range ReminderOffsets {
+		if err := CancelBatches(db, BuildLinkID(event, action)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decode a location object into *OnlineLocation, *PhysicalLocation or *HybridLocation according to its type
+// nil is returned if the location cannot be decoded
+func DecodeLocation(location interface{}) interface{} {
+	locationMap, ok := location.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var decoded interface{}
+	switch locationMap["type"] {
+	case "online":
+		decoded = &OnlineLocation{}
+	case "physical":
+		decoded = &PhysicalLocation{}
+	case "hybrid":
+		decoded = &HybridLocation{}
+	default:
+		return nil
+	}
+	if err := mapstructure.Decode(locationMap, decoded); err != nil {
+		return nil
+	}
+	return decoded
 }
 
 type OnlineLocation struct {
@@ -89,6 +408,8 @@ type OnlineLocation struct {
 	Type     string `json:"type"`
 	Platform string `json:"platform"`
 	Link     string `json:"link"`
+	// primary or secondary, this is only set for locations of a hybrid event
+	Role string `json:"role,omitempty"`
 }
 
 type PhysicalLocation struct {
@@ -99,6 +420,13 @@ type PhysicalLocation struct {
 	Address  string `json:"address"`
 	Building string `json:"building"`
 	Unit     string `json:"unit"`
+	// a private unit is only shown to users signed up, like links of online events
+	UnitPrivate bool `json:"unit_private,omitempty" mapstructure:"unit_private"`
+	// primary or secondary, this is only set for locations of a hybrid event
+	Role string `json:"role,omitempty"`
+	// coordinates are resolved by the geocoder if they are not given
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
 }
 
 /*
@@ -111,23 +439,50 @@ type EventSignup struct {
 	UserID  *uint  `gorm:"not null"`
 	User    *User  `jsonapi:"relation,user,omitempty" gorm:"PRELOAD:false"`
 
-	// Status codes:
+	// Status codes, which are changed through Transition only (see signupTransitions):
 	// - created   : signup record is initially created
+	// - waitlisted : signup record is created when the event is full, it is promoted to created when a place is released
 	// - attended  : this user's attendance is recorded by the event organizer
+	// - pending   : signup record is created for an event requiring approval, it is approved or rejected by the event organizer
+	// - rejected  : this user has been rejected by the event organizer, he/she cannot signup the event again
+	// - no_show   : this user did not turn up, as recorded by the event organizer
 	// - reviewed  : this user has left his/her review to the event
-	// - withdrawn : this user withdrawn his/her signup record to the event
-	Status      *string `jsonapi:"attr,status" gorm:"not null;default:'created'"`
-	ReviewScore *uint   `jsonapi:"attr,review_score,omitempty"`
-	ReviewText  *string `jsonapi:"attr,review_text,omitempty"`
+	// - withdrawn : this user withdrawn his/her signup record to the event, a new record is created if he/she joins again
+	Status *string `jsonapi:"attr,status" gorm:"not null;default:'created'"`
+	// code of the invite used to join an invite-only event, this is only taken from signup requests
+	InviteCode *string `jsonapi:"attr,invite_code,omitempty" gorm:"-"`
+	// how the user attends a hybrid event, one of AttendanceModes, this is empty for other events
+	AttendanceMode *string `jsonapi:"attr,attendance_mode,omitempty"`
+	// result of the lottery draw, with the rank drawn and the weight of the user in the draw
+	LotteryResult *string `jsonapi:"attr,lottery_result,omitempty"`
+	LotteryRank   *uint   `jsonapi:"attr,lottery_rank,omitempty"`
+	LotteryWeight *uint   `jsonapi:"attr,lottery_weight,omitempty"`
+	// guests brought by the user, GuestCount is public while names in Guests are only filled by LoadGuests or SetGuests
+	GuestCount *uint       `jsonapi:"attr,guest_count,omitempty" gorm:"not null;default:0"`
+	GuestsJSON *string     `jsonapi:"-"`
+	Guests     interface{} `jsonapi:"attr,guests,omitempty" gorm:"-"`
+	// the signup is offered to another user until he/she accepts or declines it, see transfer.go
+	TransferToID      *uint      `jsonapi:"attr,transfer_to_id,omitempty" gorm:"index"`
+	TransferOfferedAt *time.Time `jsonapi:"attr,transfer_offered_at,iso8601,omitempty"`
+	// the user who held this signup before it was transferred to the current user
+	TransferredFromID *uint      `jsonapi:"attr,transferred_from_id,omitempty"`
+	TransferredAt     *time.Time `jsonapi:"attr,transferred_at,iso8601,omitempty"`
+	// message of the organizer sent with the approval or rejection of a pending signup
+	DecisionMessage *string    `jsonapi:"attr,decision_message,omitempty"`
+	DecidedAt       *time.Time `jsonapi:"attr,decided_at,iso8601,omitempty"`
+	// answers to registration questions of the event, Answers is only filled by LoadAnswers or SetAnswers
+	AnswersJSON *string     `jsonapi:"-"`
+	Answers     interface{} `jsonapi:"attr,answers,omitempty" gorm:"-"`
+	ReviewScore *uint       `jsonapi:"attr,review_score,omitempty"`
+	ReviewText  *string     `jsonapi:"attr,review_text,omitempty"`
+	// the reviewer is not shown in the public listing of reviews if this is true
+	ReviewAnonymous *bool      `jsonapi:"attr,review_anonymous,omitempty"`
+	ReviewedAt      *time.Time `jsonapi:"attr,reviewed_at,iso8601,omitempty"`
+	// public reply of the organizers, each review can only be replied once
+	ReviewReply     *string    `jsonapi:"attr,review_reply,omitempty"`
+	ReviewRepliedAt *time.Time `jsonapi:"attr,review_replied_at,iso8601,omitempty"`
+	// reviews hidden by admins are excluded from review listings and rating aggregates
+	ReviewHiddenAt *time.Time `jsonapi:"attr,review_hidden_at,iso8601,omitempty"`
 
 	DBTime
 }
-
-func (signup *EventSignup) AfterDelete(tx *gorm.DB) error {
-	if *signup.Status == "created" {
-		// mark the signup record as withdrawn if it is deleted before user attend the event
-		return tx.Model(signup).Update("status", "withdrawn").Error
-	} else {
-		return nil
-	}
-}
@@ -0,0 +1,102 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/jsonapi"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+
+	"schrodinger-box/internal/misc"
+)
+
+/*
+ * event series model - a recurring event whose occurrences are stored as individual events
+ * occurrences share title, location and images of the series and link back to it through Event.SeriesID
+ */
+type EventSeries struct {
+	ID    uint    `jsonapi:"primary,event_series" gorm:"primarykey"`
+	Title *string `jsonapi:"attr,title" gorm:"not null"`
+	// begin and end time of the first occurrence
+	TimeBegin *time.Time `jsonapi:"attr,time_begin,iso8601" gorm:"not null"`
+	TimeEnd   *time.Time `jsonapi:"attr,time_end,iso8601" gorm:"not null"`
+	// iCalendar RRULE, see misc.Recurrence for parts supported
+	Recurrence *string `jsonapi:"attr,recurrence" gorm:"not null"`
+	// This is either OnlineLocation, PhysicalLocation or HybridLocation
+	LocationJSON *string     `gorm:"not null"`
+	Location     interface{} `jsonapi:"attr,location" gorm:"-"`
+	Type         *string     `jsonapi:"attr,type" gorm:"not null"`
+	Images       []*File     `jsonapi:"relation,images,omitempty" gorm:"polymorphic:Link"`
+	// capacity applied to each of the occurrences
+	Capacity *uint `jsonapi:"attr,capacity,omitempty"`
+
+	OrganizerID *uint    `gorm:"not null"`
+	Organizer   *User    `jsonapi:"relation,organizer,omitempty"`
+	Events      []*Event `jsonapi:"relation,events,omitempty" gorm:"foreignKey:SeriesID"`
+	// set by HideLocationFrom, the location shown is not the one stored
+	locationHidden bool
+
+	DBTime
+}
+
+func (series *EventSeries) JSONAPILinks() *jsonapi.Links {
+	return &jsonapi.Links{
+		"self": misc.APIAbsolutePath("/event_series/" + fmt.Sprint(series.ID)),
+	}
+}
+
+func (series *EventSeries) JSONAPIRelationshipLinks(relation string) *jsonapi.Links {
+	if relation == "organizer" {
+		return &jsonapi.Links{
+			"related": misc.APIAbsolutePath("/user/" + fmt.Sprint(*series.OrganizerID)),
+		}
+	}
+	return nil
+}
+
+func (series *EventSeries) BeforeSave(tx *gorm.DB) error {
+	if series.locationHidden {
+		return errors.New("event series cannot be saved with its location details hidden")
+	}
+	// Marshal Location object into LocationJSON
+	jsonByteSlice, err := json.Marshal(series.Location)
+	jsonString := string(jsonByteSlice)
+	series.LocationJSON = &jsonString
+	return errors.WithStack(err)
+}
+
+func (series *EventSeries) AfterSave(tx *gorm.DB) error {
+	return series.AfterFind(tx)
+}
+
+func (series *EventSeries) AfterFind(tx *gorm.DB) error {
+	// Unmarshal LocationJSON into Location object
+	err := json.Unmarshal([]byte(*series.LocationJSON), &series.Location)
+	return errors.WithStack(err)
+}
+
+// build an occurrence of this series beginning at the time given, the event is not saved here
+func (series *EventSeries) NewOccurrence(timeBegin time.Time) *Event {
+	timeEnd := timeBegin.Add(series.TimeEnd.Sub(*series.TimeBegin))
+	title := *series.Title
+	eventType := *series.Type
+	return &Event{
+		Title:       &title,
+		TimeBegin:   &timeBegin,
+		TimeEnd:     &timeEnd,
+		Location:    series.Location,
+		Type:        &eventType,
+		Capacity:    series.Capacity,
+		OrganizerID: series.OrganizerID,
+		SeriesID:    &series.ID,
+	}
+}
+
+// load occurrences of this series beginning at or after the time given in chronological order
+func (series *EventSeries) LoadOccurrences(db *gorm.DB, from time.Time) error {
+	return db.Where("series_id = ? AND time_begin >= ?", series.ID, from).
+		Order("time_begin asc").
+		Find(&series.Events).Error
+}
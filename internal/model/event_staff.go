@@ -0,0 +1,73 @@
+package model
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+/*
+ * event staff model - users running an event together with their roles
+ * the organizer of an event is its owner without a staff record, others join as staff by accepting an invitation
+ */
+type EventStaff struct {
+	ID      uint   `jsonapi:"primary,event_staff" gorm:"primarykey"`
+	EventID *uint  `gorm:"not null;index"`
+	Event   *Event `jsonapi:"relation,event,omitempty" gorm:"PRELOAD:false"`
+	UserID  *uint  `gorm:"not null;index"`
+	User    *User  `jsonapi:"relation,user,omitempty" gorm:"PRELOAD:false"`
+
+	// Role codes:
+	// - owner        : the organizer of the event, who has all permissions (never stored in staff records)
+	// - co-organizer : manages the event like the owner, except deleting it and removing other co-organizers
+	// - checker      : only marks attendance of users signed up
+	Role *string `jsonapi:"attr,role" gorm:"not null"`
+	// Status codes:
+	// - invited : the user has been invited but not yet accepted, no permission is granted
+	// - active  : the user has accepted the invitation
+	Status *string `jsonapi:"attr,status" gorm:"not null;default:'invited'"`
+
+	DBTime
+}
+
+// staff roles
+const (
+	StaffOwner       = "owner"
+	StaffCoOrganizer = "co-organizer"
+	StaffChecker     = "checker"
+)
+
+// roles which are allowed to manage an event, i.e. update, cancel and invite staff
+var ManagerRoles = []string{StaffOwner, StaffCoOrganizer}
+
+// roles which are allowed to mark attendance
+var AttendanceRoles = []string{StaffOwner, StaffCoOrganizer, StaffChecker}
+
+// get the role of a user in this event, an empty string is returned if the user is not active staff
+// the organizer is always the owner even if there is no staff record of the event
+func (event *Event) StaffRole(db *gorm.DB, userID uint) (string, error) {
+	if *event.OrganizerID == userID {
+		return StaffOwner, nil
+	}
+	staff := &EventStaff{}
+	if err := db.Where("event_id = ? AND user_id = ? AND status = ?", event.ID, userID, "active").First(staff).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return *staff.Role, nil
+}
+
+// check whether a user takes one of the roles given in this event
+func (event *Event) HasStaffRole(db *gorm.DB, userID uint, roles []string) (bool, error) {
+	role, err := event.StaffRole(db, userID)
+	if err != nil || role == "" {
+		return false, err
+	}
+	for _, allowed := range roles {
+		if role == allowed {
+			return true, nil
+		}
+	}
+	return false, nil
+}
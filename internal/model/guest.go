@@ -0,0 +1,95 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// organizers can allow at most this number of guests per signup
+const MaxGuestsLimit = 20
+
+// maximum length of names of guests
+const MaxGuestNameLength = 100
+
+// number of guests each user can bring to this event, guests are not allowed if 0 is returned
+func (event *Event) GuestLimit() uint {
+	if event.MaxGuests == nil {
+		return 0
+	}
+	return *event.MaxGuests
+}
+
+// validate names of guests given in a signup request against the limit of this event
+// names are trimmed, an empty list is returned if no guest is given
+func (event *Event) ValidateGuests(raw interface{}) ([]string, error) {
+	if raw == nil {
+		return []string{}, nil
+	}
+	given, ok := raw.([]interface{})
+	if !ok {
+		return nil, errors.New("guests must be a list of names")
+	} else if uint(len(given)) > event.GuestLimit() {
+		if event.GuestLimit() == 0 {
+			return nil, errors.New("guests are not allowed for this event")
+		}
+		return nil, fmt.Errorf("you can bring at most %d guests to this event", event.GuestLimit())
+	}
+	names := make([]string, 0, len(given))
+	for _, value := range given {
+		name, ok := value.(string)
+		if !ok {
+			return nil, errors.New("guests must be a list of names")
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, errors.New("names of guests must not be empty")
+		} else if len(name) > MaxGuestNameLength {
+			return nil, fmt.Errorf("names of guests must not be longer than %d characters", MaxGuestNameLength)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// number of places taken by this signup, which are the user and his/her guests
+func (signup *EventSignup) Places() int64 {
+	if signup.GuestCount == nil {
+		return 1
+	}
+	return 1 + int64(*signup.GuestCount)
+}
+
+// unmarshal names of guests of this signup from GuestsJSON
+func (signup *EventSignup) LoadGuests() error {
+	if signup.GuestsJSON == nil {
+		signup.Guests = nil
+		return nil
+	}
+	var guests []string
+	if err := json.Unmarshal([]byte(*signup.GuestsJSON), &guests); err != nil {
+		return err
+	}
+	signup.Guests = guests
+	return nil
+}
+
+// store names of guests validated by Event.ValidateGuests into this signup record
+func (signup *EventSignup) SetGuests(guests []string) error {
+	count := uint(len(guests))
+	signup.GuestCount = &count
+	signup.GuestsJSON = nil
+	signup.Guests = nil
+	if len(guests) == 0 {
+		return nil
+	}
+	jsonBytes, err := json.Marshal(guests)
+	if err != nil {
+		return err
+	}
+	jsonString := string(jsonBytes)
+	signup.GuestsJSON = &jsonString
+	signup.Guests = guests
+	return nil
+}
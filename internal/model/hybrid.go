@@ -0,0 +1,154 @@
+package model
+
+import (
+	"gorm.io/gorm"
+)
+
+// attendance modes of hybrid events, chosen by users when they sign up
+const (
+	AttendInPerson = "in_person"
+	AttendOnline   = "online"
+)
+
+var AttendanceModes = []string{AttendInPerson, AttendOnline}
+
+// roles of locations of a hybrid event, exactly one of them is the primary location
+const (
+	LocationPrimary   = "primary"
+	LocationSecondary = "secondary"
+)
+
+// maximum number of locations of a hybrid event
+const MaxHybridLocations = 10
+
+type HybridLocation struct {
+	// type = hybrid
+	Type string `json:"type"`
+	// physical and online locations tagged with their roles, each of them is decoded by DecodeLocation
+	Locations []interface{} `json:"locations"`
+}
+
+// decode locations of a hybrid event, locations which cannot be decoded are skipped
+func (location *HybridLocation) Parts() []interface{} {
+	parts := make([]interface{}, 0, len(location.Locations))
+	for _, part := range location.Locations {
+		switch decoded := DecodeLocation(part).(type) {
+		case *PhysicalLocation, *OnlineLocation:
+			parts = append(parts, decoded)
+		}
+	}
+	return parts
+}
+
+// the physical location where users attend in person, the primary one is preferred if there are several
+func (location *HybridLocation) Physical() *PhysicalLocation {
+	var found *PhysicalLocation
+	for _, part := range location.Parts() {
+		if physical, ok := part.(*PhysicalLocation); ok && (found == nil || physical.Role == LocationPrimary) {
+			found = physical
+		}
+	}
+	return found
+}
+
+// the online location where users attend online, the primary one is preferred if there are several
+func (location *HybridLocation) Online() *OnlineLocation {
+	var found *OnlineLocation
+	for _, part := range location.Parts() {
+		if online, ok := part.(*OnlineLocation); ok && (found == nil || online.Role == LocationPrimary) {
+			found = online
+		}
+	}
+	return found
+}
+
+// get the physical location of a location object, which is either itself or the physical part of a hybrid location
+// nil is returned if there is no physical location
+func PhysicalLocationOf(location interface{}) *PhysicalLocation {
+	switch decoded := DecodeLocation(location).(type) {
+	case *PhysicalLocation:
+		return decoded
+	case *HybridLocation:
+		return decoded.Physical()
+	}
+	return nil
+}
+
+// whether users choose how to attend this event when they sign up
+func (event *Event) IsHybrid() bool {
+	locationMap, ok := event.Location.(map[string]interface{})
+	return ok && locationMap["type"] == "hybrid"
+}
+
+// capacity of an attendance mode of this event, there is no limit if 0 is returned
+func (event *Event) ModeCapacity(mode string) uint {
+	var capacity *uint
+	switch mode {
+	case AttendInPerson:
+		capacity = event.CapacityInPerson
+	case AttendOnline:
+		capacity = event.CapacityOnline
+	}
+	if capacity == nil || !event.IsHybrid() {
+		return 0
+	}
+	return *capacity
+}
+
+// numbers of places taken by confirmed signups (users and their guests) of an event in total and of each attendance mode
+type placeCount struct {
+	total int64
+	modes map[string]int64
+}
+
+func (event *Event) countPlaces(db *gorm.DB) (*placeCount, error) {
+	var rows []struct {
+		AttendanceMode *string
+		Count          int64
+	}
+	if err := db.Model(&EventSignup{}).
+		Select("attendance_mode, SUM(1 + guest_count) AS count").
+		Where("event_id = ? AND status IN ?", event.ID, ConfirmedStatuses).
+		Group("attendance_mode").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	count := &placeCount{modes: make(map[string]int64)}
+	for _, row := range rows {
+		count.total += row.Count
+		if row.AttendanceMode != nil {
+			count.modes[*row.AttendanceMode] += row.Count
+		}
+	}
+	return count, nil
+}
+
+// whether both the event and the attendance mode (empty if the event is not hybrid) have the number of places left
+func (event *Event) hasPlace(count *placeCount, mode string, places int64) bool {
+	if event.HasCapacity() && count.total+places > int64(*event.Capacity) {
+		return false
+	} else if capacity := event.ModeCapacity(mode); capacity != 0 && count.modes[mode]+places > int64(capacity) {
+		return false
+	}
+	return true
+}
+
+// whether a signup attending in the mode given (empty if the event is not hybrid) and taking the number of places can be confirmed
+func (event *Event) HasPlaceFor(db *gorm.DB, mode string, places int64) (bool, error) {
+	if !event.HasCapacity() && event.ModeCapacity(mode) == 0 {
+		return true, nil
+	}
+	count, err := event.countPlaces(db)
+	if err != nil {
+		return false, err
+	}
+	return event.hasPlace(count, mode, places), nil
+}
+
+// attendance mode of this signup, an empty string is returned if the event is not hybrid
+func (signup *EventSignup) Mode() string {
+	if signup.AttendanceMode == nil {
+		return ""
+	}
+	return *signup.AttendanceMode
+}
@@ -0,0 +1,193 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/*
+ * lottery registration - signups collected before the draw time are pending, places are allocated by a random draw
+ * the draw is reproducible from the seed stored with the event:
+ * 1. candidates are the pending signups ordered by ID, each with the weight stored in its LotteryWeight
+ * 2. a math/rand source is seeded with the first 16 hex digits of the seed, and a number u in [0, 1) is taken for each candidate in order
+ * 3. candidates are ranked by u^(1/weight) in descending order (weighted sampling without replacement), ties are broken by signup ID
+ * 4. candidates are confirmed in the order of their ranks while there are places left, the others are waitlisted in the same order
+ */
+
+// lottery results of signups
+const (
+	LotteryWon  = "won"
+	LotteryLost = "lost"
+)
+
+// weights of users who have lost previous draws are capped so that a single user cannot dominate a draw
+const MaxLotteryWeight = 5
+
+var ErrLotteryDrawn = errors.New("lottery of this event has been drawn")
+
+// whether places of this event are allocated by a lottery
+func (event *Event) IsLottery() bool {
+	return event.LotteryDrawAt != nil
+}
+
+// whether signups of this event are still collected for the lottery, they are pending until the draw
+func (event *Event) LotteryOpen() bool {
+	return event.IsLottery() && event.LotteryDrawnAt == nil
+}
+
+// weight of a user in a weighted draw, which is 1 plus the number of draws the user has lost since his/her last win
+func lotteryWeight(db *gorm.DB, userID uint) (uint, error) {
+	var lastWin struct{ ID uint }
+	if err := db.Model(&EventSignup{}).Select("COALESCE(MAX(id), 0) AS id").
+		Where("user_id = ? AND lottery_result = ?", userID, LotteryWon).
+		Scan(&lastWin).Error; err != nil {
+		return 0, err
+	}
+	var losses int64
+	if err := db.Model(&EventSignup{}).
+		Where("user_id = ? AND lottery_result = ? AND id > ?", userID, LotteryLost, lastWin.ID).
+		Count(&losses).Error; err != nil {
+		return 0, err
+	}
+	if losses+1 > MaxLotteryWeight {
+		return MaxLotteryWeight, nil
+	}
+	return uint(losses) + 1, nil
+}
+
+// rank candidates of a draw by the seed given, candidates must be ordered by ID and have their weights set
+func rankLottery(seed string, candidates []*EventSignup) ([]*EventSignup, error) {
+	if len(seed) < 16 {
+		return nil, errors.New("lottery seed is too short")
+	}
+	seedNumber, err := strconv.ParseUint(seed[:16], 16, 64)
+	if err != nil {
+		return nil, err
+	}
+	random := rand.New(rand.NewSource(int64(seedNumber)))
+	keys := make(map[uint]float64, len(candidates))
+	for _, candidate := range candidates {
+		weight := 1.0
+		if candidate.LotteryWeight != nil && *candidate.LotteryWeight > 1 {
+			weight = float64(*candidate.LotteryWeight)
+		}
+		keys[candidate.ID] = math.Pow(random.Float64(), 1/weight)
+	}
+	ranked := append([]*EventSignup{}, candidates...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if keys[ranked[i].ID] != keys[ranked[j].ID] {
+			return keys[ranked[i].ID] > keys[ranked[j].ID]
+		}
+		return ranked[i].ID < ranked[j].ID
+	})
+	return ranked, nil
+}
+
+// draw the lottery of this event, which has to be locked in the transaction
+// winners are confirmed up to the capacity of the event (and of their attendance modes), losers are waitlisted in the order drawn
+func (event *Event) DrawLottery(db *gorm.DB, now time.Time) error {
+	if !event.IsLottery() {
+		return errors.New("places of this event are not allocated by lottery")
+	} else if event.LotteryDrawnAt != nil {
+		return ErrLotteryDrawn
+	}
+	seed, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	var candidates []*EventSignup
+	if err := db.Preload("User").Preload("User.Subscription").
+		Where("event_id = ? AND status = ?", event.ID, SignupPending).
+		Order("id asc").
+		Find(&candidates).Error; err != nil {
+		return err
+	}
+	weighted := event.LotteryWeighted != nil && *event.LotteryWeighted
+	for _, candidate := range candidates {
+		weight := uint(1)
+		if weighted {
+			if weight, err = lotteryWeight(db, *candidate.UserID); err != nil {
+				return err
+			}
+		}
+		candidate.LotteryWeight = &weight
+	}
+	ranked, err := rankLottery(seed, candidates)
+	if err != nil {
+		return err
+	}
+	count, err := event.countPlaces(db)
+	if err != nil {
+		return err
+	}
+	date := event.TimeBegin.Format(NotificationTimeFormat)
+	for i, candidate := range ranked {
+		rank := uint(i + 1)
+		action, result := SignupLoseLottery, LotteryLost
+		text := fmt.Sprintf("You have not been drawn in the lottery of \"%s\" (%s), you are now on the waitlist.", *event.Title, date)
+		if event.hasPlace(count, candidate.Mode(), candidate.Places()) {
+			action, result = SignupWinLottery, LotteryWon
+			text = fmt.Sprintf("Congratulations! You have been drawn in the lottery of \"%s\" (%s) and you are now confirmed to attend.", *event.Title, date)
+			count.total += candidate.Places()
+			count.modes[candidate.Mode()] += candidate.Places()
+		}
+		if err := candidate.Transition(db, action, map[string]interface{}{
+			"lottery_result": result,
+			"lottery_rank":   rank,
+			"lottery_weight": *candidate.LotteryWeight,
+		}); err != nil {
+			return err
+		} else if err := candidate.User.CreateNotificationAll(db, "EventUpdate", text, now); err != nil {
+			return err
+		}
+	}
+	event.LotterySeed = &seed
+	event.LotteryDrawnAt = &now
+	return db.Model(event).Updates(map[string]interface{}{"lottery_seed": seed, "lottery_drawn_at": now}).Error
+}
+
+// draw lotteries of all active events whose draw time has come, every lottery is drawn in its own transaction
+// an event failing to be drawn does not stop the others, IDs of events drawn are returned together with errors of those failed
+func DrawDueLotteries(db *gorm.DB, now time.Time) ([]uint, error) {
+	var events []*Event
+	if err := db.Where("lottery_draw_at <= ? AND lottery_drawn_at IS NULL AND status IN ?", now, []string{EventScheduled, EventPostponed}).
+		Find(&events).Error; err != nil {
+		return nil, err
+	}
+	var drawn []uint
+	var failed []string
+	for _, event := range events {
+		tx := db.Begin()
+		// the event is locked and checked again in case it has been drawn by another instance
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(event, event.ID).Error; err != nil {
+			tx.Rollback()
+			failed = append(failed, fmt.Sprintf("event %d: %s", event.ID, err.Error()))
+			continue
+		} else if err := event.DrawLottery(tx, now); errors.Is(err, ErrLotteryDrawn) {
+			tx.Rollback()
+			continue
+		} else if err != nil {
+			tx.Rollback()
+			failed = append(failed, fmt.Sprintf("event %d: %s", event.ID, err.Error()))
+			continue
+		} else if err := tx.Commit().Error; err != nil {
+			tx.Rollback()
+			failed = append(failed, fmt.Sprintf("event %d: %s", event.ID, err.Error()))
+			continue
+		}
+		drawn = append(drawn, event.ID)
+	}
+	if len(failed) != 0 {
+		return drawn, errors.New(strings.Join(failed, "; "))
+	}
+	return drawn, nil
+}
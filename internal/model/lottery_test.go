@@ -0,0 +1,94 @@
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func testCandidates(weights ...uint) []*EventSignup {
+	candidates := make([]*EventSignup, 0, len(weights))
+	for i, weight := range weights {
+		weight := weight
+		candidates = append(candidates, &EventSignup{ID: uint(i + 1), LotteryWeight: &weight})
+	}
+	return candidates
+}
+
+func rankedIDs(ranked []*EventSignup) []uint {
+	ids := make([]uint, 0, len(ranked))
+	for _, signup := range ranked {
+		ids = append(ids, signup.ID)
+	}
+	return ids
+}
+
+func TestRankLottery(t *testing.T) {
+	tests := []struct {
+		name       string
+		seed       string
+		candidates []*EventSignup
+		wantErr    bool
+	}{
+		{name: "no candidates", seed: "0123456789abcdef", candidates: nil},
+		{name: "single candidate", seed: "0123456789abcdef", candidates: testCandidates(1)},
+		{name: "equal weights", seed: "0123456789abcdef0123456789abcdef", candidates: testCandidates(1, 1, 1, 1, 1)},
+		{name: "mixed weights", seed: "fedcba9876543210", candidates: testCandidates(1, 5, 2, 1, 3)},
+		{name: "weights not set", seed: "fedcba9876543210", candidates: []*EventSignup{{ID: 1}, {ID: 2}}},
+		{name: "seed too short", seed: "0123", candidates: testCandidates(1, 1), wantErr: true},
+		{name: "seed not hex", seed: "0123456789abcdeg", candidates: testCandidates(1, 1), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ranked, err := rankLottery(test.seed, test.candidates)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("rankLottery(%q) = %v, want error", test.seed, rankedIDs(ranked))
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("rankLottery(%q) returned error: %v", test.seed, err)
+			}
+			if len(ranked) != len(test.candidates) {
+				t.Fatalf("rankLottery returned %d candidates, want %d", len(ranked), len(test.candidates))
+			}
+			seen := make(map[uint]bool)
+			for _, signup := range ranked {
+				if seen[signup.ID] {
+					t.Fatalf("candidate %d is ranked twice", signup.ID)
+				}
+				seen[signup.ID] = true
+			}
+			// the draw is reproducible from the seed
+			again, _ := rankLottery(test.seed, test.candidates)
+			if !reflect.DeepEqual(rankedIDs(ranked), rankedIDs(again)) {
+				t.Errorf("rankLottery is not reproducible: %v then %v", rankedIDs(ranked), rankedIDs(again))
+			}
+		})
+	}
+}
+
+func TestRankLotteryKeepsCandidates(t *testing.T) {
+	candidates := testCandidates(1, 1, 1)
+	if _, err := rankLottery("0123456789abcdef", candidates); err != nil {
+		t.Fatalf("rankLottery returned error: %v", err)
+	} else if ids := rankedIDs(candidates); !reflect.DeepEqual(ids, []uint{1, 2, 3}) {
+		t.Errorf("candidates given are reordered to %v", ids)
+	}
+}
+
+func TestRankLotteryWeights(t *testing.T) {
+	// with weights 1 and 5 the heavier candidate is drawn first with probability 5/6
+	draws, firsts := 2000, 0
+	for i := 0; i < draws; i++ {
+		ranked, err := rankLottery(fmt.Sprintf("%016x", i), testCandidates(1, 5))
+		if err != nil {
+			t.Fatalf("rankLottery returned error: %v", err)
+		} else if ranked[0].ID == 2 {
+			firsts++
+		}
+	}
+	if ratio := float64(firsts) / float64(draws); ratio < 0.78 || ratio > 0.88 {
+		t.Errorf("candidate of weight 5 is drawn first in %.2f of draws, want about 0.83", ratio)
+	}
+}
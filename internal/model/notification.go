@@ -97,6 +97,23 @@ type SMSVerification struct {
 	DBTime
 }
 
+// time format used when a time is written into notification texts
+const NotificationTimeFormat = "2006-01-02 15:04"
+
+// EventReminder batches are generated at this offset before an event begins, keyed by the action part of LinkID
+var ReminderOffsets = map[string]time.Duration{
+	"1day":  24 * time.Hour,
+	"4hr":   4 * time.Hour,
+	"30min": 30 * time.Minute,
+}
+
+// default templates used when reminder batches are scheduled for an event
+var ReminderTemplates = map[string]string{
+	"1day":  "Hi :nickname:, a reminder that \":event_title:\" will begin in 1 day (:time_begin:).",
+	"4hr":   "Hi :nickname:, a reminder that \":event_title:\" will begin in 4 hours (:time_begin:).",
+	"30min": "Hi :nickname:, \":event_title:\" is starting in 30 minutes (:time_begin:). See you there!",
+}
+
 var ServicePrefix = map[string]string{
 	"telegram": "Telegram",
 	"email":    "Email",
@@ -135,12 +152,15 @@ func (batch *NotificationBatch) AfterUpdate(tx *gorm.DB) error {
 
 // build link ID and insert record to database
 // flags[0] - whether cancel before create; returns error if duplicate LinkID found and this is set to false; default false
-func (batch *NotificationBatch) Create(db *gorm.DB, link interface{}, action string) error {
-	linkID := reflect.TypeOf(link).String() +
-		strconv.Itoa(int(reflect.ValueOf(link).FieldByName("ID").Uint())) +
-		action
-	dupNotification := &Notification{}
-	if err := db.Model(Notification{}).Where("link_id", linkID).First(dupNotification).Error; err == nil {
+func (batch *NotificationBatch) Create(db *gorm.DB, link interface{}, action string, flags ...bool) error {
+	linkID := BuildLinkID(link, action)
+	if len(flags) > 0 && flags[0] {
+		if err := CancelBatches(db, linkID); err != nil {
+			return err
+		}
+	}
+	dupBatch := &NotificationBatch{}
+	if err := db.Where("link_id = ?", linkID).First(dupBatch).Error; err == nil {
 		return errors.New("duplicate LinkID is found")
 	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 		// something other than record not found occurred
@@ -150,6 +170,26 @@ func (batch *NotificationBatch) Create(db *gorm.DB, link interface{}, action str
 	return db.Save(batch).Error
 }
 
+// build link ID in the format of Type-ID-action (e.g. Event-123-1day) for a resource object
+func BuildLinkID(link interface{}, action string) string {
+	value := reflect.Indirect(reflect.ValueOf(link))
+	return value.Type().Name() + "-" + strconv.Itoa(int(value.FieldByName("ID").Uint())) + "-" + action
+}
+
+// cancel all batches with the given LinkID which have not been generated yet
+func CancelBatches(db *gorm.DB, linkID string) error {
+	var batches []*NotificationBatch
+	if err := db.Where("link_id = ? AND status = ?", linkID, "created").Find(&batches).Error; err != nil {
+		return err
+	}
+	for _, batch := range batches {
+		if err := batch.Cancelled(db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (batch *NotificationBatch) GenText(replacements map[string]string) string {
 	val := *batch.Template
 	for k, v := range replacements {
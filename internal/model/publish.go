@@ -0,0 +1,102 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// publish status codes of events
+const (
+	EventDraft     = "draft"
+	EventPublished = "published"
+)
+
+// the event has already been published, possibly by another request or instance
+var ErrEventPublished = errors.New("event has already been published")
+
+// whether the event is visible to everyone
+func (event *Event) IsPublished() bool {
+	return event.PublishStatus == nil || *event.PublishStatus == EventPublished
+}
+
+// publish a draft, users who might be interested in the event are sent suggestions
+// the draft status is checked again when updating so that suggestions are only sent once if the event is published concurrently
+func (event *Event) Publish(db *gorm.DB, now time.Time) error {
+	publishStatus := EventPublished
+	result := db.Model(&Event{}).
+		Where("id = ? AND publish_status = ?", event.ID, EventDraft).
+		Updates(map[string]interface{}{"publish_status": publishStatus, "published_at": now})
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return ErrEventPublished
+	}
+	event.PublishStatus = &publishStatus
+	event.PublishedAt = &now
+	return event.suggest(db, now)
+}
+
+// send EventSuggestion notifications to users who have signed up for events of the same organizer or with any of the same tags
+// only public events are suggested, like they are the only ones listed by VisibleEvents
+func (event *Event) suggest(db *gorm.DB, sendTime time.Time) error {
+	if !event.IsActive() || sendTime.After(*event.TimeBegin) {
+		return nil
+	} else if !event.IsOpen() || (event.Visibility != nil && *event.Visibility != EventPublic) {
+		return nil
+	}
+	tags := db.Session(&gorm.Session{}).Table("event_tags").Select("tag_id").Where("event_id = ?", event.ID)
+	tagged := db.Session(&gorm.Session{}).Table("event_tags").Select("event_id").Where("tag_id IN (?)", tags)
+	related := db.Session(&gorm.Session{}).Model(&Event{}).Select("id").
+		Where("(organizer_id = ? OR id IN (?))", *event.OrganizerID, tagged)
+	signedUp := db.Session(&gorm.Session{}).Model(&EventSignup{}).Select("user_id").
+		Where("status IN ? AND event_id <> ? AND event_id IN (?)", ConfirmedStatuses, event.ID, related)
+	var users []*User
+	if err := db.Preload("Subscription").
+		Where("id <> ? AND id IN (?)", *event.OrganizerID, signedUp).
+		Find(&users).Error; err != nil {
+		return err
+	}
+	text := fmt.Sprintf("You might be interested in \"%s\" (%s), which has just been published.",
+		*event.Title, event.TimeBegin.Format(NotificationTimeFormat))
+	for _, user := range users {
+		if err := user.CreateNotificationAll(db, "EventSuggestion", text, sendTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publish all drafts whose publishing time has come, every event is published in its own transaction
+// an event failing to be published does not stop the others, IDs of events published are returned together with errors of those failed
+func PublishDueEvents(db *gorm.DB, now time.Time) ([]uint, error) {
+	var events []*Event
+	if err := db.Where("publish_status = ? AND publish_at <= ?", EventDraft, now).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	var published []uint
+	var failed []string
+	for _, event := range events {
+		tx := db.Begin()
+		if err := event.Publish(tx, now); errors.Is(err, ErrEventPublished) {
+			tx.Rollback()
+			continue
+		} else if err != nil {
+			tx.Rollback()
+			failed = append(failed, fmt.Sprintf("event %d: %s", event.ID, err.Error()))
+			continue
+		} else if err := tx.Commit().Error; err != nil {
+			tx.Rollback()
+			failed = append(failed, fmt.Sprintf("event %d: %s", event.ID, err.Error()))
+			continue
+		}
+		published = append(published, event.ID)
+	}
+	if len(failed) != 0 {
+		return published, errors.New(strings.Join(failed, "; "))
+	}
+	return published, nil
+}
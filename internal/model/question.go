@@ -0,0 +1,266 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+/*
+ * registration questions - a schema attached to an event which users answer when they sign up
+ * answers are stored in signup records as an object keyed by question IDs
+ */
+type EventQuestion struct {
+	// unique among questions of the same event, answers are keyed by this
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Label string `json:"label"`
+	// a required question must be answered with a non-empty value
+	Required bool `json:"required"`
+	// choices of single_choice and multi_choice questions
+	Options []string `json:"options,omitempty"`
+	// range of number questions, both ends are optional
+	Min *float64 `json:"min,omitempty"`
+	Max *float64 `json:"max,omitempty"`
+}
+
+// question types
+const (
+	QuestionText         = "text"
+	QuestionSingleChoice = "single_choice"
+	QuestionMultiChoice  = "multi_choice"
+	QuestionNumber       = "number"
+)
+
+const (
+	MaxQuestions       = 20
+	MaxQuestionOptions = 50
+	MaxAnswerLength    = 1000
+)
+
+// decode and validate a question schema given in a request, an empty schema is decoded as nil
+func DecodeQuestions(raw interface{}) ([]*EventQuestion, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	jsonBytes, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var questions []*EventQuestion
+	if err := json.Unmarshal(jsonBytes, &questions); err != nil {
+		return nil, errors.New("questions must be an array of question objects")
+	} else if len(questions) > MaxQuestions {
+		return nil, fmt.Errorf("an event can have at most %d questions", MaxQuestions)
+	}
+	ids := make(map[string]bool)
+	for _, question := range questions {
+		if question == nil || question.ID == "" || strings.TrimSpace(question.Label) == "" {
+			return nil, errors.New("every question must have an ID and a label")
+		} else if ids[question.ID] {
+			return nil, fmt.Errorf("question ID %s is duplicated", question.ID)
+		}
+		ids[question.ID] = true
+		switch question.Type {
+		case QuestionText, QuestionNumber:
+			if len(question.Options) != 0 {
+				return nil, fmt.Errorf("question %s cannot have options", question.ID)
+			}
+		case QuestionSingleChoice, QuestionMultiChoice:
+			if len(question.Options) == 0 || len(question.Options) > MaxQuestionOptions {
+				return nil, fmt.Errorf("question %s must have 1 to %d options", question.ID, MaxQuestionOptions)
+			}
+			options := make(map[string]bool)
+			for _, option := range question.Options {
+				if option == "" || options[option] {
+					return nil, fmt.Errorf("options of question %s must be non-empty and unique", question.ID)
+				}
+				options[option] = true
+			}
+		default:
+			return nil, fmt.Errorf("question %s has an unknown type", question.ID)
+		}
+		if question.Type != QuestionNumber && (question.Min != nil || question.Max != nil) {
+			return nil, fmt.Errorf("only number questions can have a range")
+		} else if question.Min != nil && question.Max != nil && *question.Min > *question.Max {
+			return nil, fmt.Errorf("range of question %s is empty", question.ID)
+		}
+	}
+	if len(questions) == 0 {
+		return nil, nil
+	}
+	return questions, nil
+}
+
+// get the questions of this event, which are decoded when the event is loaded or validated
+func (event *Event) QuestionList() []*EventQuestion {
+	questions, _ := event.Questions.([]*EventQuestion)
+	return questions
+}
+
+// validate answers given in a signup request against the questions of this event
+// answers are normalized so that only questions answered are kept
+func (event *Event) ValidateAnswers(raw interface{}) (map[string]interface{}, error) {
+	answers := make(map[string]interface{})
+	if raw != nil {
+		given, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("answers must be an object keyed by question IDs")
+		}
+		for id, value := range given {
+			if value != nil {
+				answers[id] = value
+			}
+		}
+	}
+	questions := event.QuestionList()
+	known := make(map[string]bool)
+	for _, question := range questions {
+		known[question.ID] = true
+		value, answered := answers[question.ID]
+		if !answered {
+			if question.Required {
+				return nil, fmt.Errorf("question \"%s\" is required", question.Label)
+			}
+			continue
+		}
+		normalized, err := question.validate(value)
+		if err != nil {
+			return nil, fmt.Errorf("answer to question \"%s\" is invalid: %s", question.Label, err.Error())
+		} else if normalized == nil {
+			if question.Required {
+				return nil, fmt.Errorf("question \"%s\" is required", question.Label)
+			}
+			delete(answers, question.ID)
+			continue
+		}
+		answers[question.ID] = normalized
+	}
+	for id := range answers {
+		if !known[id] {
+			return nil, fmt.Errorf("question %s does not exist", id)
+		}
+	}
+	return answers, nil
+}
+
+// validate an answer to this question, nil is returned if the answer is empty
+func (question *EventQuestion) validate(value interface{}) (interface{}, error) {
+	switch question.Type {
+	case QuestionText:
+		text, ok := value.(string)
+		if !ok {
+			return nil, errors.New("it must be a string")
+		} else if len(text) > MaxAnswerLength {
+			return nil, fmt.Errorf("it must not be longer than %d characters", MaxAnswerLength)
+		} else if strings.TrimSpace(text) == "" {
+			return nil, nil
+		}
+		return text, nil
+	case QuestionSingleChoice:
+		choice, ok := value.(string)
+		if !ok {
+			return nil, errors.New("it must be one of the options")
+		} else if choice == "" {
+			return nil, nil
+		} else if !question.hasOption(choice) {
+			return nil, errors.New("it must be one of the options")
+		}
+		return choice, nil
+	case QuestionMultiChoice:
+		values, ok := value.([]interface{})
+		if !ok {
+			return nil, errors.New("it must be an array of options")
+		}
+		choices := make([]string, 0, len(values))
+		chosen := make(map[string]bool)
+		for _, value := range values {
+			choice, ok := value.(string)
+			if !ok || !question.hasOption(choice) {
+				return nil, errors.New("it must be an array of options")
+			} else if !chosen[choice] {
+				chosen[choice] = true
+				choices = append(choices, choice)
+			}
+		}
+		if len(choices) == 0 {
+			return nil, nil
+		}
+		return choices, nil
+	case QuestionNumber:
+		number, ok := value.(float64)
+		if !ok || math.IsNaN(number) || math.IsInf(number, 0) {
+			return nil, errors.New("it must be a number")
+		} else if question.Min != nil && number < *question.Min {
+			return nil, fmt.Errorf("it must not be less than %g", *question.Min)
+		} else if question.Max != nil && number > *question.Max {
+			return nil, fmt.Errorf("it must not be greater than %g", *question.Max)
+		}
+		return number, nil
+	}
+	return nil, errors.New("question type is unknown")
+}
+
+func (question *EventQuestion) hasOption(choice string) bool {
+	for _, option := range question.Options {
+		if option == choice {
+			return true
+		}
+	}
+	return false
+}
+
+// format an answer to this question as text, e.g. for a cell of roster export
+func (question *EventQuestion) Format(value interface{}) string {
+	switch answer := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return answer
+	case float64:
+		return fmt.Sprint(answer)
+	case []interface{}:
+		choices := make([]string, 0, len(answer))
+		for _, choice := range answer {
+			choices = append(choices, fmt.Sprint(choice))
+		}
+		return strings.Join(choices, "; ")
+	case []string:
+		return strings.Join(answer, "; ")
+	}
+	return fmt.Sprint(value)
+}
+
+// decode answers stored in this signup record so that they are shown in the response
+// answers are private to the user and organizers, so they are not decoded when the signup is loaded
+func (signup *EventSignup) LoadAnswers() error {
+	if signup.AnswersJSON == nil {
+		signup.Answers = nil
+		return nil
+	}
+	var answers map[string]interface{}
+	if err := json.Unmarshal([]byte(*signup.AnswersJSON), &answers); err != nil {
+		return err
+	}
+	signup.Answers = answers
+	return nil
+}
+
+// store answers validated by Event.ValidateAnswers into this signup record
+func (signup *EventSignup) SetAnswers(answers map[string]interface{}) error {
+	signup.AnswersJSON = nil
+	signup.Answers = nil
+	if len(answers) == 0 {
+		return nil
+	}
+	jsonBytes, err := json.Marshal(answers)
+	if err != nil {
+		return err
+	}
+	jsonString := string(jsonBytes)
+	signup.AnswersJSON = &jsonString
+	signup.Answers = answers
+	return nil
+}
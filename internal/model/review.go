@@ -0,0 +1,161 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+ * reviews left by users on events they attended, these are stored in their signup records
+ * EventReview is how a review is shown publicly, reviewers who choose to stay anonymous are not linked to their reviews
+ * organizers can reply to a review once, users can flag reviews and admins hide flagged ones from listings and aggregates
+ */
+type EventReview struct {
+	// this is the same as the ID of the signup record
+	ID         uint       `jsonapi:"primary,event_review"`
+	EventID    uint       `jsonapi:"attr,event_id"`
+	Score      *uint      `jsonapi:"attr,score"`
+	Text       *string    `jsonapi:"attr,text,omitempty"`
+	Anonymous  bool       `jsonapi:"attr,anonymous"`
+	ReviewedAt *time.Time `jsonapi:"attr,reviewed_at,iso8601,omitempty"`
+	// these are left empty if the review is anonymous
+	UserID    *uint      `jsonapi:"attr,user_id,omitempty"`
+	Nickname  *string    `jsonapi:"attr,nickname,omitempty"`
+	Reply     *string    `jsonapi:"attr,reply,omitempty"`
+	RepliedAt *time.Time `jsonapi:"attr,replied_at,iso8601,omitempty"`
+}
+
+// report of a review which is abusive or inappropriate, each user can flag a review once
+type ReviewFlag struct {
+	ID       uint         `jsonapi:"primary,review_flag" gorm:"primarykey"`
+	SignupID *uint        `gorm:"not null;index"`
+	Signup   *EventSignup `jsonapi:"-" gorm:"PRELOAD:false"`
+	// public view of the review flagged, this is filled from Signup before responding
+	Review *EventReview `jsonapi:"relation,review,omitempty" gorm:"-"`
+	UserID *uint        `gorm:"not null;index"`
+	User   *User        `jsonapi:"relation,user,omitempty" gorm:"PRELOAD:false"`
+	Reason *string      `jsonapi:"attr,reason" gorm:"not null"`
+	// Status codes:
+	// - open      : the flag has not been handled by admins
+	// - hidden    : the review has been hidden by admins
+	// - dismissed : admins decided to keep the review
+	Status *string `jsonapi:"attr,status" gorm:"not null;default:'open'"`
+
+	DBTime
+}
+
+// maximum length of the reason of a flag
+const MaxFlagReasonLength = 500
+
+// review scores range from 1 to MaxReviewScore
+const MaxReviewScore = 5
+
+// RatingSummary aggregates review scores, the histogram counts reviews of each score
+type RatingSummary struct {
+	Average   float64      `json:"average"`
+	Count     int          `json:"count"`
+	Histogram map[uint]int `json:"histogram"`
+}
+
+// OrganizerReputation summarizes reviews of all past events organized by a user
+type OrganizerReputation struct {
+	// number of events organized which have ended and were not cancelled
+	PastEvents int64          `json:"past_events"`
+	Rating     *RatingSummary `json:"rating"`
+}
+
+func NewRatingSummary() *RatingSummary {
+	histogram := make(map[uint]int)
+	for score := uint(1); score <= MaxReviewScore; score++ {
+		histogram[score] = 0
+	}
+	return &RatingSummary{Histogram: histogram}
+}
+
+// add a number of reviews of the same score to the summary
+func (rating *RatingSummary) Add(score uint, count int) {
+	if count == 0 {
+		return
+	}
+	total := rating.Average*float64(rating.Count) + float64(score)*float64(count)
+	rating.Count += count
+	rating.Average = total / float64(rating.Count)
+	rating.Histogram[score] += count
+}
+
+// get the public view of the review in a signup record, the user has to be loaded unless the review is anonymous
+func (signup *EventSignup) Review() *EventReview {
+	review := &EventReview{
+		ID:         signup.ID,
+		EventID:    *signup.EventID,
+		Score:      signup.ReviewScore,
+		Text:       signup.ReviewText,
+		Anonymous:  signup.ReviewAnonymous != nil && *signup.ReviewAnonymous,
+		ReviewedAt: signup.ReviewedAt,
+		Reply:      signup.ReviewReply,
+		RepliedAt:  signup.ReviewRepliedAt,
+	}
+	if !review.Anonymous && signup.User != nil {
+		review.UserID = signup.UserID
+		review.Nickname = signup.User.Nickname
+	}
+	return review
+}
+
+// clear the review in this signup unless the viewer (nil if anonymous) is its author
+// reviews of other users are only served through Review(), which keeps anonymous reviewers anonymous
+// the author still sees a review hidden by admins, but only with the time it was hidden
+func (signup *EventSignup) HideReviewFrom(viewer *User) {
+	if viewer != nil && signup.UserID != nil && *signup.UserID == viewer.ID {
+		if signup.ReviewHiddenAt != nil {
+			signup.ReviewScore = nil
+			signup.ReviewText = nil
+		}
+		return
+	}
+	signup.ReviewScore = nil
+	signup.ReviewText = nil
+	signup.ReviewAnonymous = nil
+	signup.ReviewedAt = nil
+	signup.ReviewReply = nil
+	signup.ReviewRepliedAt = nil
+	signup.ReviewHiddenAt = nil
+}
+
+// clear reviews in loaded signups of this event which are not written by the viewer (nil if anonymous)
+func (event *Event) HideReviewsFrom(viewer *User) {
+	for _, signup := range event.EventSignups {
+		signup.HideReviewFrom(viewer)
+	}
+}
+
+// compute the reputation of this user as an organizer
+func (user *User) LoadReputation(db *gorm.DB) error {
+	reputation := &OrganizerReputation{Rating: NewRatingSummary()}
+	now := time.Now()
+	past := func() *gorm.DB {
+		return db.Model(&Event{}).Where("organizer_id = ? AND time_end < ? AND status <> ?", user.ID, now, EventCancelled)
+	}
+	if err := past().Count(&reputation.PastEvents).Error; err != nil {
+		return err
+	}
+	var scores []struct {
+		ReviewScore uint
+		Count       int
+	}
+	if err := db.Model(&EventSignup{}).
+		Select("event_signups.review_score, COUNT(*) AS count").
+		Where("event_signups.status = ? AND event_signups.review_score IS NOT NULL", "reviewed").
+		Where("event_signups.review_hidden_at IS NULL").
+		Where("event_signups.event_id IN (?)", past().Select("id")).
+		Group("event_signups.review_score").
+		Scan(&scores).Error; err != nil {
+		return err
+	}
+	for _, score := range scores {
+		reputation.Rating.Add(score.ReviewScore, score.Count)
+	}
+	user.Reputation = reputation
+	return nil
+}
@@ -0,0 +1,181 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// status codes of signups, see EventSignup.Status
+const (
+	SignupCreated    = "created"
+	SignupWaitlisted = "waitlisted"
+	SignupAttended   = "attended"
+	SignupReviewed   = "reviewed"
+	SignupWithdrawn  = "withdrawn"
+	SignupNoShow     = "no_show"
+	SignupPending    = "pending"
+	SignupRejected   = "rejected"
+)
+
+// signups of these status codes are only kept as history, they are not listed with events or users
+var UnlistedStatuses = []string{SignupWithdrawn, SignupRejected}
+
+// actions changing the status of a signup after it is created
+const (
+	// a waitlisted signup takes a place released
+	SignupPromote = "promote"
+	// the user withdraws before attending, a new signup can be created afterwards to re-join the event
+	SignupWithdraw = "withdraw"
+	// event staff records the attendance of the user
+	SignupMarkAttended = "mark_attended"
+	// event staff records that the user did not turn up
+	SignupMarkNoShow = "mark_no_show"
+	// event staff reverts attendance or no-show marked by mistake
+	SignupRevertAttendance = "revert_attendance"
+	// the user leaves a review after attending
+	SignupReview = "review"
+	// organizers approve a pending signup of an event requiring approval, it is waitlisted if the event is full
+	SignupApprove           = "approve"
+	SignupApproveWaitlisted = "approve_waitlisted"
+	// organizers reject a pending signup, the user cannot sign up for the event again
+	SignupReject = "reject"
+	// a pending signup of a lottery event is drawn or not drawn, the latter is waitlisted
+	SignupWinLottery  = "win_lottery"
+	SignupLoseLottery = "lose_lottery"
+)
+
+type signupTransition struct {
+	from []string
+	to   string
+}
+
+// the state machine of signups, the status of a signup can only be changed by these actions through Transition
+// withdrawn, rejected and reviewed signups cannot be changed any more
+var signupTransitions = map[string]signupTransition{
+	SignupPromote:           {from: []string{SignupWaitlisted}, to: SignupCreated},
+	SignupWithdraw:          {from: []string{SignupCreated, SignupWaitlisted, SignupPending}, to: SignupWithdrawn},
+	SignupMarkAttended:      {from: []string{SignupCreated, SignupNoShow}, to: SignupAttended},
+	SignupMarkNoShow:        {from: []string{SignupCreated, SignupAttended}, to: SignupNoShow},
+	SignupRevertAttendance:  {from: []string{SignupAttended, SignupNoShow}, to: SignupCreated},
+	SignupReview:            {from: []string{SignupAttended}, to: SignupReviewed},
+	SignupApprove:           {from: []string{SignupPending}, to: SignupCreated},
+	SignupApproveWaitlisted: {from: []string{SignupPending}, to: SignupWaitlisted},
+	SignupReject:            {from: []string{SignupPending}, to: SignupRejected},
+	SignupWinLottery:        {from: []string{SignupPending}, to: SignupCreated},
+	SignupLoseLottery:       {from: []string{SignupPending}, to: SignupWaitlisted},
+}
+
+var (
+	// the action cannot be taken in the current status of the signup
+	ErrSignupTransition = errors.New("signup status cannot be changed in this way")
+	// the user already holds a signup of the event which has not been withdrawn
+	ErrSignupExists = errors.New("you have already signed up for this event")
+	// the user has been rejected by organizers of the event
+	ErrSignupRejected = errors.New("your signup for this event has been rejected")
+)
+
+// whether an action can be taken on a signup of the status given
+func CanTransition(status string, action string) bool {
+	transition, ok := signupTransitions[action]
+	if !ok {
+		return false
+	}
+	for _, from := range transition.from {
+		if status == from {
+			return true
+		}
+	}
+	return false
+}
+
+// the status a signup is changed to by the action, an empty string is returned if the action is unknown
+func TransitionTarget(action string) string {
+	return signupTransitions[action].to
+}
+
+// change the status of this signup by the action given, fields given are updated together with the status
+// an error wrapping ErrSignupTransition is returned if the action is not allowed, or the signup has been changed concurrently
+func (signup *EventSignup) Transition(db *gorm.DB, action string, fields map[string]interface{}) error {
+	if !CanTransition(*signup.Status, action) {
+		return fmt.Errorf("%w: %s signup cannot be changed by %s", ErrSignupTransition, *signup.Status, action)
+	}
+	to := signupTransitions[action].to
+	updates := map[string]interface{}{"status": to}
+	for column, value := range fields {
+		updates[column] = value
+	}
+	// the status is checked again when updating in case it has been changed by another request
+	result := db.Model(&EventSignup{}).Where("id = ? AND status = ?", signup.ID, *signup.Status).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: signup has been changed by another request", ErrSignupTransition)
+	}
+	signup.Status = &to
+	return nil
+}
+
+// find the signup of a user to this event which has not been withdrawn, nil is returned if there is none
+// a user can hold at most one such signup of each event, signups withdrawn before are kept as history
+func (event *Event) ActiveSignup(db *gorm.DB, userID uint) (*EventSignup, error) {
+	signup := &EventSignup{}
+	if err := db.Where("event_id = ? AND user_id = ? AND status <> ?", event.ID, userID, SignupWithdrawn).
+		Order("id desc").
+		First(signup).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return signup, nil
+}
+
+// maximum length of messages sent with approvals and rejections
+const MaxDecisionMessageLength = 500
+
+// whether new signups of this event are pending until they are approved
+func (event *Event) NeedsApproval() bool {
+	return event.RequiresApproval != nil && *event.RequiresApproval
+}
+
+// approve or reject a pending signup of this event, which has to be locked in the transaction
+// an approved signup is waitlisted if there is no place left, the user is notified with the message given (empty if none)
+func (event *Event) DecideSignup(db *gorm.DB, signup *EventSignup, approve bool, message string, now time.Time) error {
+	action := SignupReject
+	if approve {
+		action = SignupApprove
+		if available, err := event.HasPlaceFor(db, signup.Mode(), signup.Places()); err != nil {
+			return err
+		} else if !available {
+			action = SignupApproveWaitlisted
+		}
+	}
+	fields := map[string]interface{}{"decided_at": now, "decision_message": nil}
+	if message != "" {
+		fields["decision_message"] = message
+	}
+	if err := signup.Transition(db, action, fields); err != nil {
+		return err
+	}
+	signup.DecidedAt = &now
+	signup.DecisionMessage = nil
+	if message != "" {
+		signup.DecisionMessage = &message
+	}
+	var text string
+	switch action {
+	case SignupApprove:
+		text = "Your signup for \"%s\" (%s) has been approved."
+	case SignupApproveWaitlisted:
+		text = "Your signup for \"%s\" (%s) has been approved, but the event is full and you are now on the waitlist."
+	case SignupReject:
+		text = "Your signup for \"%s\" (%s) has been rejected."
+	}
+	text = fmt.Sprintf(text, *event.Title, event.TimeBegin.Format(NotificationTimeFormat))
+	if message != "" {
+		text += "\nMessage from the organizer: " + message
+	}
+	return signup.User.CreateNotificationAll(db, "EventUpdate", text, now)
+}
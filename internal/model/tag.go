@@ -0,0 +1,65 @@
+package model
+
+import (
+	"github.com/google/jsonapi"
+	"gorm.io/gorm"
+)
+
+/*
+ * tag model - managed vocabulary of tags describing events
+ * tags are defined in the configuration file and linked to events through the join table event_tags
+ */
+type Tag struct {
+	ID          uint    `jsonapi:"primary,tag" gorm:"primarykey"`
+	Name        *string `jsonapi:"attr,name" gorm:"not null;unique;size:64"`
+	Description *string `jsonapi:"attr,description,omitempty"`
+
+	// number of events tagged, this is only filled by CountTagUsages and will not be logged in the database
+	UsageCount *int64 `jsonapi:"-" gorm:"-"`
+
+	DBTime
+}
+
+func (tag *Tag) JSONAPIMeta() *jsonapi.Meta {
+	if tag.UsageCount == nil {
+		return nil
+	}
+	return &jsonapi.Meta{
+		"usage_count": *tag.UsageCount,
+	}
+}
+
+// create tags in the vocabulary which do not exist yet, existing tags are left untouched
+func SeedTags(db *gorm.DB, names []string) error {
+	for _, name := range names {
+		tagName := name
+		if err := db.Where("name = ?", name).FirstOrCreate(&Tag{Name: &tagName}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fill UsageCount of tags given with the number of events tagged with each of them
+func CountTagUsages(db *gorm.DB, tags []*Tag) error {
+	var usages []struct {
+		TagID uint
+		Count int64
+	}
+	if err := db.Table("event_tags").
+		Select("event_tags.tag_id, COUNT(*) AS count").
+		Joins("JOIN events ON events.id = event_tags.event_id AND events.deleted_at IS NULL").
+		Group("event_tags.tag_id").
+		Scan(&usages).Error; err != nil {
+		return err
+	}
+	counts := make(map[uint]int64)
+	for _, usage := range usages {
+		counts[usage.TagID] = usage.Count
+	}
+	for _, tag := range tags {
+		count := counts[tag.ID]
+		tag.UsageCount = &count
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+ * transfer of signups - the holder of a signup offers it to another registered user, who has to accept it
+ * the signup keeps its status and place, the recipient answers registration questions again and guests are dropped
+ * signups of invite-only, approval and lottery events cannot be transferred, as the recipient would skip their checks
+ * a signup can only be offered to one user at a time, the offer is cancelled by the holder or declined by the recipient
+ */
+
+// signups of these status codes can be transferred, the place (or the position on the waitlist) is passed on
+var TransferableStatuses = []string{SignupCreated, SignupWaitlisted}
+
+var (
+	// the signup cannot be transferred in its current status, or it has been changed concurrently
+	ErrTransferNotAllowed = errors.New("only confirmed or waitlisted signups can be transferred")
+	// the signup has already been offered to a user
+	ErrTransferPending = errors.New("this signup has already been offered to another user")
+	// there is no offer of the signup to the user
+	ErrTransferNotFound = errors.New("this signup has not been offered to you")
+)
+
+// whether signups of this event can be transferred, the recipient of a transfer is not vetted like users signing up
+func (event *Event) AllowsTransfer() bool {
+	return event.IsOpen() && !event.NeedsApproval() && !event.IsLottery()
+}
+
+// whether this signup can be offered to another user
+func (signup *EventSignup) Transferable() bool {
+	for _, status := range TransferableStatuses {
+		if *signup.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// offer this signup to the recipient given, who is notified to accept or decline it
+// signup.Event has to be loaded, the recipient must not hold a signup of the event
+func (signup *EventSignup) OfferTransfer(db *gorm.DB, recipient *User, now time.Time) error {
+	if !signup.Transferable() {
+		return ErrTransferNotAllowed
+	} else if signup.TransferToID != nil {
+		return ErrTransferPending
+	}
+	// the status and the offer are checked again when updating in case they have been changed by another request
+	result := db.Model(&EventSignup{}).
+		Where("id = ? AND status IN ? AND transfer_to_id IS NULL", signup.ID, TransferableStatuses).
+		Updates(map[string]interface{}{"transfer_to_id": recipient.ID, "transfer_offered_at": now})
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: signup has been changed by another request", ErrTransferNotAllowed)
+	}
+	signup.TransferToID = &recipient.ID
+	signup.TransferOfferedAt = &now
+	text := fmt.Sprintf("A signup for \"%s\" (%s) has been offered to you. Accept it to take it over, or decline it.",
+		*signup.Event.Title, signup.Event.TimeBegin.Format(NotificationTimeFormat))
+	return recipient.CreateNotificationAll(db, "EventUpdate", text, now)
+}
+
+// cancel the pending offer of this signup, either by its holder or by the recipient declining it
+// the other party is notified, signup.Event has to be loaded
+func (signup *EventSignup) CancelTransfer(db *gorm.DB, notified *User, declined bool, now time.Time) error {
+	if signup.TransferToID == nil {
+		return ErrTransferNotFound
+	}
+	result := db.Model(&EventSignup{}).
+		Where("id = ? AND transfer_to_id = ?", signup.ID, *signup.TransferToID).
+		Updates(map[string]interface{}{"transfer_to_id": nil, "transfer_offered_at": nil})
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: signup has been changed by another request", ErrTransferNotFound)
+	}
+	signup.TransferToID = nil
+	signup.TransferOfferedAt = nil
+	text := "The offer of a signup for \"%s\" (%s) has been cancelled."
+	if declined {
+		text = "Your offer of your signup for \"%s\" (%s) has been declined."
+	}
+	text = fmt.Sprintf(text, *signup.Event.Title, signup.Event.TimeBegin.Format(NotificationTimeFormat))
+	return notified.CreateNotificationAll(db, "EventUpdate", text, now)
+}
+
+// transfer a signup of this event offered to the recipient, the event has to be locked in the transaction
+// answers of the previous holder are replaced by those of the recipient validated by ValidateAnswers
+// guests of the previous holder are dropped and places released are offered to the waitlist
+// the previous holder (signup.User) is notified, the signup is then held by the recipient
+func (event *Event) AcceptTransfer(db *gorm.DB, signup *EventSignup, recipient *User, answers map[string]interface{}, now time.Time) error {
+	if signup.TransferToID == nil || *signup.TransferToID != recipient.ID {
+		return ErrTransferNotFound
+	} else if !signup.Transferable() {
+		return ErrTransferNotAllowed
+	}
+	// a user can hold at most one signup of each event
+	if active, err := event.ActiveSignup(db, recipient.ID); err != nil {
+		return err
+	} else if active != nil && *active.Status == SignupRejected {
+		return ErrSignupRejected
+	} else if active != nil {
+		return ErrSignupExists
+	}
+	previousID := *signup.UserID
+	released := *signup.Status == SignupCreated && signup.Places() > 1
+	if err := signup.SetAnswers(answers); err != nil {
+		return err
+	} else if err := signup.SetGuests(nil); err != nil {
+		return err
+	}
+	result := db.Model(&EventSignup{}).
+		Where("id = ? AND status IN ? AND transfer_to_id = ?", signup.ID, TransferableStatuses, recipient.ID).
+		Updates(map[string]interface{}{
+			"user_id":             recipient.ID,
+			"answers_json":        signup.AnswersJSON,
+			"guests_json":         nil,
+			"guest_count":         0,
+			"transfer_to_id":      nil,
+			"transfer_offered_at": nil,
+			"transferred_from_id": previousID,
+			"transferred_at":      now,
+		})
+	if result.Error != nil {
+		return result.Error
+	} else if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: signup has been changed by another request", ErrTransferNotAllowed)
+	}
+	previous := signup.User
+	signup.UserID = &recipient.ID
+	signup.User = recipient
+	signup.TransferToID = nil
+	signup.TransferOfferedAt = nil
+	signup.TransferredFromID = &previousID
+	signup.TransferredAt = &now
+	text := fmt.Sprintf("Your signup for \"%s\" (%s) has been transferred to %s.",
+		*event.Title, event.TimeBegin.Format(NotificationTimeFormat), *recipient.Nickname)
+	if err := previous.CreateNotificationAll(db, "EventUpdate", text, now); err != nil {
+		return err
+	} else if released {
+		return event.PromoteWaitlist(db)
+	}
+	return nil
+}
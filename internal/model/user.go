@@ -27,6 +27,10 @@ type User struct {
 	EmailMD5     string                    `jsonapi:"attr,email_md5" gorm:"-"`
 	EventSignups []*EventSignup            `jsonapi:"relation,event_signups,omitempty"`
 	Subscription *NotificationSubscription `jsonapi:"-"`
+	// secret in the URL of this user's calendar feed, the feed is disabled if this is empty
+	CalendarSecret *string `jsonapi:"-" gorm:"index"`
+	// this is only filled by LoadReputation and will not be logged in the database
+	Reputation *OrganizerReputation `jsonapi:"-" gorm:"-"`
 
 	DBTime
 }
@@ -37,9 +41,28 @@ func (user *User) JSONAPILinks() *jsonapi.Links {
 	}
 }
 
+func (user *User) JSONAPIMeta() *jsonapi.Meta {
+	if user.Reputation == nil {
+		return nil
+	}
+	return &jsonapi.Meta{
+		"organizer_reputation": user.Reputation,
+	}
+}
+
+// administrators are listed by NUSID in the configuration file
+func (user *User) IsAdmin() bool {
+	for _, nusid := range viper.GetStringSlice("admins") {
+		if nusid != "" && nusid == user.NUSID {
+			return true
+		}
+	}
+	return false
+}
+
 func (user *User) LoadSignups(db *gorm.DB) error {
-	// loading all events signed up by the user with event data side-loaded
-	return db.Model(user).Preload("Event").Preload("Event.Organizer").Association("EventSignups").Find(&user.EventSignups)
+	// loading all events signed up by the user with event data side-loaded, signups withdrawn or rejected are left out
+	return db.Model(user).Preload("Event").Preload("Event.Organizer").Association("EventSignups").Find(&user.EventSignups, "status NOT IN ?", UnlistedStatuses)
 }
 
 func (user *User) AfterFind(tx *gorm.DB) error {
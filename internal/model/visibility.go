@@ -0,0 +1,238 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// visibility levels of events
+const (
+	// listed and open to everyone
+	EventPublic = "public"
+	// not listed, but anyone with the ID of the event can see and join it
+	EventUnlisted = "unlisted"
+	// only visible to event staff, users signed up and holders of an invite code, who are the only ones able to join
+	EventInviteOnly = "invite_only"
+)
+
+var EventVisibilities = []string{EventPublic, EventUnlisted, EventInviteOnly}
+
+/*
+ * invite model - codes issued by organizers to let users see and join an invite-only event
+ * invites are never preloaded with events so that their codes are not leaked
+ */
+type EventInvite struct {
+	ID      uint   `jsonapi:"primary,event_invite" gorm:"primarykey"`
+	EventID *uint  `gorm:"not null;index"`
+	Event   *Event `jsonapi:"relation,event,omitempty" gorm:"PRELOAD:false"`
+	Code    string `jsonapi:"attr,code" gorm:"not null;uniqueIndex;size:32"`
+	// the invite can be used without limit if MaxUses is empty or 0
+	MaxUses   *uint      `jsonapi:"attr,max_uses,omitempty"`
+	UsedCount uint       `jsonapi:"attr,used_count" gorm:"not null;default:0"`
+	ExpiresAt *time.Time `jsonapi:"attr,expires_at,iso8601,omitempty"`
+	// link to the event carrying the invite code, this is filled before responding
+	Link        string `jsonapi:"attr,link,omitempty" gorm:"-"`
+	CreatedByID *uint  `gorm:"not null"`
+
+	DBTime
+}
+
+var (
+	ErrInviteInvalid   = errors.New("invite code is invalid")
+	ErrInviteExpired   = errors.New("invite code has expired")
+	ErrInviteExhausted = errors.New("invite code has been used up")
+)
+
+// whether the event is visible to users who are not listed as its staff, signed up or invited
+func (event *Event) IsOpen() bool {
+	return event.Visibility == nil || *event.Visibility != EventInviteOnly
+}
+
+// whether a user (nil if the request is anonymous) can see this event with the invite code given (empty if none)
+// drafts are only visible to organizers, invite-only events to event staff, users signed up and holders of a valid invite code
+func (event *Event) VisibleTo(db *gorm.DB, user *User, inviteCode string) (bool, error) {
+	if event.IsPublished() && event.IsOpen() {
+		return true, nil
+	} else if !event.IsPublished() {
+		if user == nil {
+			return false, nil
+		}
+		return event.HasStaffRole(db, user.ID, ManagerRoles)
+	}
+	if user != nil {
+		var signups int64
+		if role, err := event.StaffRole(db, user.ID); err != nil || role != "" {
+			return role != "", err
+		} else if err := db.Model(&EventSignup{}).
+			Where("event_id = ? AND user_id = ? AND status NOT IN ?", event.ID, user.ID, UnlistedStatuses).
+			Count(&signups).Error; err != nil || signups != 0 {
+			return signups != 0, err
+		}
+	}
+	if inviteCode == "" {
+		return false, nil
+	} else if _, err := event.FindInvite(db, inviteCode, time.Now()); errors.Is(err, ErrInviteInvalid) ||
+		errors.Is(err, ErrInviteExpired) || errors.Is(err, ErrInviteExhausted) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// leave out occurrences of this series which are not visible to the user (nil if the request is anonymous)
+func (series *EventSeries) FilterVisibleOccurrences(db *gorm.DB, user *User) error {
+	visible := make([]*Event, 0, len(series.Events))
+	for _, event := range series.Events {
+		if ok, err := event.VisibleTo(db, user, ""); err != nil {
+			return err
+		} else if ok {
+			visible = append(visible, event)
+		}
+	}
+	series.Events = visible
+	return nil
+}
+
+// scope of events listed to a user (nil if the request is anonymous)
+// only published public events are listed, except those run by the user as the organizer or a co-organizer
+func VisibleEvents(db *gorm.DB, user *User) *gorm.DB {
+	if user == nil {
+		return db.Where("events.publish_status = ? AND events.visibility = ?", EventPublished, EventPublic)
+	}
+	coOrganized := db.Session(&gorm.Session{}).Model(&EventStaff{}).Select("event_id").
+		Where("user_id = ? AND status = ? AND role = ?", user.ID, "active", StaffCoOrganizer)
+	return db.Where("((events.publish_status = ? AND events.visibility = ?) OR events.organizer_id = ? OR events.id IN (?))",
+		EventPublished, EventPublic, user.ID, coOrganized)
+}
+
+// find a usable invite of this event by its code, the invite row is locked if db is in a transaction
+func (event *Event) FindInvite(db *gorm.DB, code string, now time.Time) (*EventInvite, error) {
+	invite := &EventInvite{}
+	if err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("event_id = ? AND code = ?", event.ID, code).
+		First(invite).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInviteInvalid
+	} else if err != nil {
+		return nil, err
+	} else if invite.ExpiresAt != nil && !now.Before(*invite.ExpiresAt) {
+		return nil, ErrInviteExpired
+	} else if invite.MaxUses != nil && *invite.MaxUses != 0 && invite.UsedCount >= *invite.MaxUses {
+		return nil, ErrInviteExhausted
+	}
+	return invite, nil
+}
+
+// count a use of this invite, this has to be done in the transaction where the invite is found
+func (invite *EventInvite) Use(db *gorm.DB) error {
+	invite.UsedCount++
+	return db.Model(invite).Update("used_count", gorm.Expr("used_count + 1")).Error
+}
+
+// generate a random code for a new invite
+func NewInviteCode() (string, error) {
+	return randomHex(10)
+}
+
+// placeholder flags shown in place of location details hidden from users who have not signed up
+const (
+	LinkHiddenFlag = "link_available_after_signup"
+	UnitHiddenFlag = "unit_available_after_signup"
+)
+
+// whether a user (nil if the request is anonymous) can see details of the event location
+// the link of an online event and the private unit of a physical event are only shown to event staff and users with a confirmed signup
+func (event *Event) LocationVisibleTo(db *gorm.DB, user *User) (bool, error) {
+	if user == nil {
+		return false, nil
+	} else if role, err := event.StaffRole(db, user.ID); err != nil || role != "" {
+		return role != "", err
+	}
+	// signups loaded by LoadSignups are checked without querying them again
+	if event.SignupCounts != nil {
+		for _, signup := range event.EventSignups {
+			if *signup.UserID == user.ID && isConfirmedStatus(*signup.Status) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	var signups int64
+	err := db.Model(&EventSignup{}).
+		Where("event_id = ? AND user_id = ? AND status IN ?", event.ID, user.ID, ConfirmedStatuses).
+		Count(&signups).Error
+	return signups != 0, err
+}
+
+// hide details of the event location (and of its series if loaded) from a user who cannot see them
+// the event is marked so that it cannot be saved with its location details hidden
+func (event *Event) HideLocationFrom(db *gorm.DB, user *User) error {
+	if visible, err := event.LocationVisibleTo(db, user); err != nil || visible {
+		return err
+	}
+	event.Location = hideLocationDetails(event.Location)
+	event.locationHidden = true
+	if event.Series != nil {
+		event.Series.Location = hideLocationDetails(event.Series.Location)
+		event.Series.locationHidden = true
+	}
+	return nil
+}
+
+// hide details of the series location from users other than its organizer, occurrences loaded are checked one by one
+func (series *EventSeries) HideLocationFrom(db *gorm.DB, user *User) error {
+	if user != nil && *series.OrganizerID == user.ID {
+		return nil
+	}
+	series.Location = hideLocationDetails(series.Location)
+	series.locationHidden = true
+	for _, event := range series.Events {
+		if err := event.HideLocationFrom(db, user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copy a location object with its details replaced by placeholder flags
+func hideLocationDetails(location interface{}) interface{} {
+	locationMap, ok := location.(map[string]interface{})
+	if !ok {
+		return location
+	}
+	hidden := make(map[string]interface{}, len(locationMap)+1)
+	for key, value := range locationMap {
+		hidden[key] = value
+	}
+	switch locationMap["type"] {
+	case "online":
+		delete(hidden, "link")
+		hidden[LinkHiddenFlag] = true
+	case "physical":
+		if unitPrivate, _ := locationMap["unit_private"].(bool); unitPrivate && locationMap["unit"] != "" {
+			delete(hidden, "unit")
+			hidden[UnitHiddenFlag] = true
+		}
+	case "hybrid":
+		if parts, ok := locationMap["locations"].([]interface{}); ok {
+			hiddenParts := make([]interface{}, 0, len(parts))
+			for _, part := range parts {
+				hiddenParts = append(hiddenParts, hideLocationDetails(part))
+			}
+			hidden["locations"] = hiddenParts
+		}
+	}
+	return hidden
+}
+
+func isConfirmedStatus(status string) bool {
+	for _, confirmed := range ConfirmedStatuses {
+		if status == confirmed {
+			return true
+		}
+	}
+	return false
+}
@@ -59,8 +59,14 @@ func main() {
 	tables := []interface{}{
 		model.Token{},
 		model.User{},
+		model.Tag{},
 		model.Event{},
+		model.EventSeries{},
 		model.EventSignup{},
+		model.EventStaff{},
+		model.EventInvite{},
+		model.EventCheckin{},
+		model.ReviewFlag{},
 		model.Notification{},
 		model.NotificationBatch{},
 		model.NotificationSubscription{},
@@ -72,6 +78,19 @@ func main() {
 	} else {
 		debugPrint("Database migrated")
 	}
+	if err := model.SeedTags(db, viper.GetStringSlice("tags")); err != nil {
+		panic("Failed to create tags: " + err.Error())
+	}
+
+	// geocoder resolving coordinates of physical locations
+	if postalCodes := viper.GetString("external.geocoder.postalCodes"); postalCodes != "" {
+		geocoder, err := external.NewPostalCodeGeocoder(postalCodes)
+		if err != nil {
+			panic("Failed to load postal code table: " + err.Error())
+		}
+		external.ActiveGeocoder = geocoder
+		debugPrint("Postal code table loaded with %d zip codes", geocoder.Size())
+	}
 
 	router := gin.Default()
 	router.LoadHTMLGlob("templates/*")
@@ -103,10 +122,46 @@ func main() {
 		eventRouter.Use(middleware.TokenMiddleware())
 		{
 			eventRouter.POST("", api.EventCreate)
+			eventRouter.PATCH("", api.EventUpdate)
 			eventRouter.GET("/:id", api.EventGet)
+			eventRouter.GET("/:id/ics", api.EventICS)
 			eventRouter.DELETE("/:id", api.EventDelete)
+			eventRouter.POST("/:id/cancel", api.EventCancel)
+			eventRouter.POST("/:id/publish", api.EventPublish)
+			eventRouter.POST("/:id/invites", api.EventInviteCreate)
+			eventRouter.GET("/:id/invites", api.EventInvitesGet)
+			eventRouter.DELETE("/:id/invites/:invite_id", api.EventInviteDelete)
+			eventRouter.POST("/:id/staff", api.EventStaffCreate)
+			eventRouter.POST("/:id/staff/:staff_id/accept", api.EventStaffAccept)
+			eventRouter.DELETE("/:id/staff/:staff_id", api.EventStaffDelete)
+			eventRouter.GET("/:id/checkin_code", api.EventCheckinCodeGet)
+			eventRouter.POST("/:id/checkin", api.EventCheckinCreate)
+			eventRouter.GET("/:id/checkins", api.EventCheckinsGet)
+			eventRouter.POST("/:id/attendance", api.EventAttendanceUpdate)
+			eventRouter.GET("/:id/roster", api.EventRosterGet)
+			eventRouter.GET("/:id/pending_signups", api.EventPendingSignupsGet)
+			eventRouter.POST("/:id/pending_signups/:signup_id/approve", api.EventSignupApprove)
+			eventRouter.POST("/:id/pending_signups/:signup_id/reject", api.EventSignupReject)
+			eventRouter.GET("/:id/reviews", api.EventReviewsGet)
+			eventRouter.POST("/:id/reviews/:review_id/reply", api.EventReviewReply)
+			eventRouter.POST("/:id/reviews/:review_id/flags", api.ReviewFlagCreate)
+			eventRouter.POST("/:id/reviews/:review_id/hide", api.EventReviewHide)
 		}
 		apiRouter.GET("/events", middleware.TokenMiddleware(), api.EventsGet)
+		apiRouter.GET("/tags", middleware.TokenMiddleware(), api.TagsGet)
+		apiRouter.GET("/review_flags", middleware.TokenMiddleware(), api.ReviewFlagsGet)
+		apiRouter.POST("/review_flags/:id/dismiss", middleware.TokenMiddleware(), api.ReviewFlagDismiss)
+
+		eventSeriesRouter := apiRouter.Group("/event_series")
+		eventSeriesRouter.Use(middleware.TokenMiddleware())
+		{
+			eventSeriesRouter.POST("", api.EventSeriesCreate)
+			eventSeriesRouter.PATCH("", api.EventSeriesUpdate)
+			eventSeriesRouter.GET("/:id", api.EventSeriesGet)
+			eventSeriesRouter.DELETE("/:id", api.EventSeriesDelete)
+			eventSeriesRouter.POST("/:id/signup", api.EventSeriesSignupCreate)
+			eventSeriesRouter.DELETE("/:id/signup", api.EventSeriesSignupDelete)
+		}
 
 		eventSignupRouter := apiRouter.Group("/event_signup")
 		eventSignupRouter.Use(middleware.TokenMiddleware())
@@ -114,6 +169,9 @@ func main() {
 			eventSignupRouter.POST("", api.EventSignupCreate)
 			eventSignupRouter.PATCH("", api.EventSignupUpdate)
 			eventSignupRouter.DELETE("/:id", api.EventSignupDelete)
+			eventSignupRouter.POST("/:id/transfer", api.EventSignupTransferCreate)
+			eventSignupRouter.POST("/:id/transfer/accept", api.EventSignupTransferAccept)
+			eventSignupRouter.DELETE("/:id/transfer", api.EventSignupTransferDelete)
 		}
 
 		fileRouter := apiRouter.Group("/file")
@@ -127,6 +185,10 @@ func main() {
 
 		apiRouter.POST("/sms_bind/:number", middleware.TokenMiddleware(), api.UserSMSBind)
 		apiRouter.DELETE("/sms_bind/:number", middleware.TokenMiddleware(), api.UserSMSUnbind)
+
+		apiRouter.POST("/calendar_feed", middleware.TokenMiddleware(), api.CalendarFeedCreate)
+		apiRouter.DELETE("/calendar_feed", middleware.TokenMiddleware(), api.CalendarFeedDelete)
+		apiRouter.GET("/calendar_feed/:secret", api.CalendarFeedGet)
 	}
 
 	callbackRouter := router.Group("/callback")
@@ -142,6 +204,12 @@ func main() {
 	if _, err := c.AddFunc(viper.GetString("external.notification.cron"), func() { external.NotificationCron(db) }); err != nil {
 		panic("Unable to start cron for Notification - " + err.Error())
 	}
+	if _, err := c.AddFunc(viper.GetString("publishCron"), func() { external.PublishCron(db) }); err != nil {
+		panic("Unable to start cron for publishing events - " + err.Error())
+	}
+	if _, err := c.AddFunc(viper.GetString("lotteryCron"), func() { external.LotteryCron(db) }); err != nil {
+		panic("Unable to start cron for drawing lotteries - " + err.Error())
+	}
 	for _, enabledService := range enabledServices {
 		switch enabledService {
 		case "telegram":